@@ -2,112 +2,361 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
 
 	"go-payment-gateway/internal/admin"
+	"go-payment-gateway/internal/api"
+	"go-payment-gateway/internal/inbound"
 	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/journal"
+	"go-payment-gateway/internal/netmgmt"
+	"go-payment-gateway/internal/reversal"
 	"go-payment-gateway/internal/transport"
 )
 
 func main() {
 	var (
-		endpoint     = flag.String("endpoint", "127.0.0.1:5001", "upstream host:port")
+		endpoints    = flag.String("endpoint", "127.0.0.1:5001", "comma-separated upstream host:port list, primary first")
+		policy       = flag.String("lb-policy", "failover", "link selection: failover, round-robin, least-outstanding or echo-weighted")
 		tlsEnable    = flag.Bool("tls", false, "enable TLS to upstream")
+		tlsCA        = flag.String("tls-ca", "", "PEM CA bundle for verifying the upstream (default: system roots)")
+		tlsCert      = flag.String("tls-cert", "", "client certificate PEM for mutual TLS")
+		tlsKey       = flag.String("tls-key", "", "client private key PEM for mutual TLS")
+		tlsName      = flag.String("tls-server-name", "", "expected upstream certificate name (default: endpoint host)")
+		tlsMin       = flag.String("tls-min-version", "1.2", "minimum TLS version: 1.2 or 1.3")
+		tlsCiphers   = flag.String("tls-ciphers", "", "comma-separated TLS 1.2 cipher suites (default: Go defaults)")
+		tlsPins      = flag.String("tls-pin", "", "comma-separated base64 SHA-256 SPKI pins")
+		tlsInsecure  = flag.Bool("tls-insecure", false, "skip upstream certificate verification (lab use only)")
 		adminAddr    = flag.String("admin", ":8080", "admin http listen addr")
+		apiAddr      = flag.String("api", ":8081", "merchant-facing JSON API listen addr")
+		signOn       = flag.Bool("sign-on", true, "sign on (0800/001) before sending financial traffic on a link")
+		keyInterval  = flag.Duration("key-interval", 0, "period between 0800/161 key requests after sign-on (0 disables)")
 		echoInterval = flag.Duration("echo-interval", 15*time.Second, "period between 0800 echo tests")
+		echoTimeout  = flag.Duration("echo-timeout", 10*time.Second, "how long to wait for an 0810 echo response")
+		echoMissed   = flag.Int("echo-max-missed", 3, "consecutive missed echoes before -echo-action (0 disables)")
+		echoAct      = flag.String("echo-action", "degrade", "after missed echoes: degrade (stop routing to the link) or reconnect")
+		respTimeout  = flag.Duration("response-timeout", 30*time.Second, "how long to wait for a response to a request")
+		revFile      = flag.String("reversal-file", "reversals.json", "file persisting pending reversals")
+		revKey       = flag.String("reversal-key", "", "hex AES key sealing DE2 in -reversal-file (empty: DE2 is not stored)")
+		revAdvice    = flag.Bool("reversal-advice", false, "send 0420 reversal advices instead of 0400 requests")
+		revInterval  = flag.Duration("reversal-interval", 30*time.Second, "period between reversal delivery attempts")
+		journalDir   = flag.String("journal-dir", "journal", "directory for the transaction journal (empty disables)")
+		journalMax   = flag.Int64("journal-max-size", 64<<20, "rotate the journal file after this many bytes")
+		specPath     = flag.String("spec", "", "JSON field spec file (default: built-in common spec)")
+		charset      = flag.String("charset", "", "override the spec's wire character set: ascii, cp037 (ebcdic) or cp500")
+		mli          = flag.String("mli", "2be", "message length indicator: 2be, 2le, 4be or 4ascii")
+		mliIncl      = flag.Bool("mli-inclusive", false, "MLI counts its own bytes")
+		header       = flag.String("header", "", "hex header after the MLI, e.g. a TPDU")
+		macAlg       = flag.String("mac", "", "MAC algorithm overriding the spec's: x9.9, x9.19 or iso9797-alg3")
+		macKey       = flag.String("mac-key", "", "hex MAC key; enables DE64/DE128 MACs on sent messages and rejects received ones that fail verification")
 	)
 	flag.Parse()
 
+	spec, err := iso8583.ResolveSpec(*specPath, *charset)
+	if err != nil {
+		log.Fatalf("spec: %v", err)
+	}
+	if spec, err = iso8583.ResolveMAC(spec, *macAlg, *macKey); err != nil {
+		log.Fatalf("mac: %v", err)
+	}
+	log.Printf("using spec %q (charset %v)", spec.Name, spec.Charset)
+	if spec.MAC != nil && spec.MAC.Key != nil {
+		log.Printf("MACing messages with %s", spec.MAC.Algorithm)
+	}
+	framer, err := transport.NewFramer(*mli, *mliIncl, *header)
+	if err != nil {
+		log.Fatalf("framing: %v", err)
+	}
+
+	lbPolicy, err := transport.ParsePolicy(*policy)
+	if err != nil {
+		log.Fatalf("lb-policy: %v", err)
+	}
+	echoAction, err := netmgmt.ParseEchoAction(*echoAct)
+	if err != nil {
+		log.Fatalf("echo-action: %v", err)
+	}
+	eps := strings.Split(*endpoints, ",")
+
+	var tlsOpts *transport.TLSOptions
+	if *tlsEnable {
+		tlsOpts, err = buildTLSOptions(eps[0], *tlsCA, *tlsCert, *tlsKey, *tlsName, *tlsMin, *tlsCiphers, *tlsPins, *tlsInsecure)
+		if err != nil {
+			log.Fatalf("tls: %v", err)
+		}
+	}
+
+	var stan int64 = time.Now().Unix() % 1000000 // seed
+	nextSTAN := func() int { return int(atomic.AddInt64(&stan, 1) % 1000000) }
+
+	var jnl *journal.Journal
+	if *journalDir != "" {
+		if jnl, err = journal.Open(journal.Config{Dir: *journalDir, MaxBytes: *journalMax}); err != nil {
+			log.Fatalf("journal: %v", err)
+		}
+	}
+
 	st := &admin.State{Started: time.Now()}
-	st.Conn.Endpoint = *endpoint
-
-	conn := transport.NewConnector(transport.DialConfig{
-		Endpoint:  *endpoint,
-		TLS:       *tlsEnable,
-		Timeout:   5 * time.Second,
-		KeepAlive: 30 * time.Second,
-		ReadIdle:  60 * time.Second,
-		RetryBacko: 2 * time.Second,
+	var links []*transport.Link
+	var mgrs []*netmgmt.Manager
+	var echoes []*netmgmt.EchoMonitor
+	for _, ep := range eps {
+		ep = strings.TrimSpace(ep)
+		cs := &admin.ConnStat{Endpoint: ep}
+		st.Links = append(st.Links, cs)
+		link := transport.NewLink(ep, transport.DialConfig{
+			Endpoint:   ep,
+			TLS:        tlsOpts,
+			Timeout:    5 * time.Second,
+			KeepAlive:  30 * time.Second,
+			ReadIdle:   60 * time.Second,
+			RetryBacko: 2 * time.Second,
+			Framer:     framer,
+			Verify:     macVerifier(ep, cs, spec),
+		}, spec, *respTimeout)
+		var nm *netmgmt.Manager
+		if *signOn {
+			nm = netmgmt.New(netmgmt.Config{
+				Name:        ep,
+				NextSTAN:    nextSTAN,
+				Timeout:     *respTimeout,
+				KeyInterval: *keyInterval,
+				OnKey:       func(string) { log.Printf("%s: received new working key", ep) },
+				OnChange:    cs.SetNetMgmt,
+			}, link)
+			mgrs = append(mgrs, nm)
+		}
+		wireLink(link, cs, spec, nm, jnl)
+		var ready func() bool
+		if nm != nil {
+			ready = nm.SignedOn
+		}
+		echoes = append(echoes, netmgmt.NewEchoMonitor(netmgmt.EchoConfig{
+			Name:      ep,
+			Interval:  *echoInterval,
+			Timeout:   *echoTimeout,
+			MaxMissed: *echoMissed,
+			Action:    echoAction,
+			NextSTAN:  nextSTAN,
+			Ready:     ready,
+			OnResult:  echoRecorder(link, cs),
+		}, link))
+		links = append(links, link)
+	}
+	group := transport.NewGroup(lbPolicy, links...)
+
+	revKeyBytes, err := hex.DecodeString(*revKey)
+	if err != nil {
+		log.Fatalf("reversal key: %v", err)
+	}
+	if len(revKeyBytes) == 0 {
+		revKeyBytes = nil
+	}
+	revs, err := reversal.NewManager(reversal.Config{
+		Path:     *revFile,
+		Key:      revKeyBytes,
+		Advice:   *revAdvice,
+		Interval: *revInterval,
+		NextSTAN: nextSTAN,
+	}, group)
+	if err != nil {
+		log.Fatalf("reversals: %v", err)
+	}
+	if n := len(revs.List()); n > 0 {
+		log.Printf("resuming %d pending reversals from %s", n, *revFile)
+	}
+	revCtx, revStop := context.WithCancel(context.Background())
+	go revs.Run(revCtx)
+
+	group.Start()
+	adm := admin.Serve(*adminAddr, st, jnl)
+	apiSrv := api.Serve(*apiAddr, spec, group, nextSTAN, func(m *iso8583.Message) {
+		if err := revs.Add(m); err != nil {
+			log.Printf("queue reversal for STAN=%06d: %v", iso8583.MustParseSTAN(m), err)
+			return
+		}
+		log.Printf("queued reversal for timed-out %s STAN=%06d", m.MTI, iso8583.MustParseSTAN(m))
 	})
 
-	var stan int64 = time.Now().Unix() % 1000000 // seed
+	echoCtx, echoStop := context.WithCancel(context.Background())
+	for _, e := range echoes {
+		go e.Run(echoCtx)
+	}
 
-	conn.SetCallbacks(
+	// graceful shutdown
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	<-c
+	echoStop()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = apiSrv.Shutdown(ctx) // let in-flight authorizations finish first
+	revStop()
+	// Each sign-off gets its own deadline, so a slow API drain or a slow
+	// link cannot leave the others without time to send their 0800.
+	for _, nm := range mgrs {
+		signOffCtx, signOffCancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := nm.SignOff(signOffCtx); err != nil {
+			log.Printf("sign-off: %v", err)
+		}
+		signOffCancel()
+	}
+	group.Close()
+	admCtx, admCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer admCancel()
+	_ = adm.Shutdown(admCtx)
+	if jnl != nil {
+		_ = jnl.Close()
+	}
+	log.Println("gateway stopped")
+}
+
+// macVerifier returns the DialConfig.Verify check for spec's MACs, or nil
+// when MACs are off.
+func macVerifier(name string, cs *admin.ConnStat, spec *iso8583.Spec) func([]byte) error {
+	if spec.MAC == nil || spec.MAC.Key == nil {
+		return nil
+	}
+	return func(b []byte) error {
+		err := spec.VerifyMAC(b)
+		if err != nil {
+			atomic.AddUint64(&cs.MACFailures, 1)
+			log.Printf("RX on %s dropped: %v", name, err)
+		}
+		return err
+	}
+}
+
+// wireLink installs the callbacks that feed one link's admin counters and
+// journal, its network management state machine, if any, and the inbound
+// handlers that answer host-initiated requests.
+func wireLink(link *transport.Link, cs *admin.ConnStat, spec *iso8583.Spec, nm *netmgmt.Manager, jnl *journal.Journal) {
+	handlers := inbound.NewDefaultRegistry()
+	if nm != nil {
+		nm.Register(handlers)
+	}
+	record := func(dir, outcome string, m *iso8583.Message) {
+		if jnl == nil {
+			return
+		}
+		if err := jnl.Append(journal.NewEntry(dir, link.Name, transport.KeyOf(m).String(), outcome, m)); err != nil {
+			log.Printf("journal: %v", err)
+		}
+	}
+	link.Corr.SetObserver(func(e transport.Event) {
+		dir := journal.Inbound
+		if e.Outbound {
+			dir = journal.Outbound
+			if e.Outcome == transport.OutcomeSent {
+				atomic.AddUint64(&cs.TxMsgs, 1)
+			}
+		}
+		record(dir, e.Outcome, e.Msg)
+	})
+	link.Corr.SetOrphanHandler(func(m *iso8583.Message) {
+		atomic.AddUint64(&cs.Orphans, 1)
+		log.Printf("RX orphan response on %s, key=%s: %s", link.Name, transport.KeyOf(m), m)
+	})
+	link.SetCallbacks(
 		func(msg []byte) {
-			atomic.AddUint64(&st.Conn.RxMsgs, 1)
-			m, err := iso8583.Unpack(msg)
+			atomic.AddUint64(&cs.RxMsgs, 1)
+			m, err := iso8583.Unpack(spec, msg)
 			if err != nil {
-				log.Printf("RX unpack error: %v", err)
-				atomic.AddUint64(&st.Conn.Errs, 1)
+				log.Printf("RX unpack error on %s: %v", link.Name, err)
+				atomic.AddUint64(&cs.Errs, 1)
 				return
 			}
-			if iso8583.IsEchoResponse(m) {
-				log.Printf("RX 0810 echo response, STAN=%06d", iso8583.MustParseSTAN(m))
-			} else {
-				log.Printf("RX %s (not handled in skeleton)", m.MTI)
+			if link.Corr.Deliver(m) {
+				return
+			}
+			resp, ok := handlers.Dispatch(m)
+			if !ok {
+				log.Printf("RX on %s, no handler: %s", link.Name, m)
+				return
 			}
+			if resp == nil {
+				return
+			}
+			b, err := resp.Pack(spec)
+			if err == nil {
+				err = link.Conn.Send(b)
+			}
+			if err != nil {
+				log.Printf("TX %s on %s: %v", resp.MTI, link.Name, err)
+				atomic.AddUint64(&cs.Errs, 1)
+				record(journal.Outbound, transport.OutcomeSendFailed, resp)
+				return
+			}
+			atomic.AddUint64(&cs.TxMsgs, 1)
+			record(journal.Outbound, transport.OutcomeSent, resp)
 		},
 		func() {
-			st.Conn.Up = true
-			st.Conn.LastChangeTs = time.Now()
-			log.Printf("connected to %s (tls=%v)", *endpoint, *tlsEnable)
+			t := link.Conn.TLSInfo()
+			cs.SetUp(true, t)
+			if t != nil {
+				log.Printf("connected to %s (%s %s, peer %q valid until %s)", link.Name, t.Version, t.CipherSuite, t.PeerSubject, t.PeerNotAfter.Format(time.RFC3339))
+			} else {
+				log.Printf("connected to %s (tls=false)", link.Name)
+			}
+			if nm != nil {
+				nm.LinkUp()
+			}
 		},
 		func(err error) {
-			st.Conn.Up = false
-			st.Conn.LastChangeTs = time.Now()
-			log.Printf("disconnected from %s: %v", *endpoint, err)
+			cs.SetUp(false, nil)
+			log.Printf("disconnected from %s: %v", link.Name, err)
+			if nm != nil {
+				nm.LinkDown(err)
+			}
 		},
 	)
+}
 
-	conn.Start()
-	adm := admin.Serve(*adminAddr, st)
-
-	// periodic echo sender
-	stop := make(chan struct{})
-	go func() {
-		t := time.NewTicker(*echoInterval)
-		defer t.Stop()
-		for {
-			select {
-			case <-t.C:
-				if !st.Conn.Up { continue }
-				s := int(atomic.AddInt64(&stan, 1))
-				m := iso8583.NewEchoRequest(s)
-				b, err := m.Pack()
-				if err != nil {
-					log.Printf("pack error: %v", err)
-					atomic.AddUint64(&st.Conn.Errs, 1)
-					continue
-				}
-				if err := conn.Send(b); err != nil {
-					log.Printf("TX error: %v", err)
-					atomic.AddUint64(&st.Conn.Errs, 1)
-					continue
-				}
-				st.Conn.LastEchoSTAN = s
-				st.Conn.LastEchoAt = time.Now()
-				atomic.AddUint64(&st.Conn.TxMsgs, 1)
-				log.Printf("TX 0800 echo request, STAN=%06d", s)
-			case <-stop:
-				return
-			}
+// echoRecorder returns the EchoMonitor callback that feeds a link's admin
+// counters and its echo-weighted health.
+func echoRecorder(link *transport.Link, cs *admin.ConnStat) func(int, time.Duration, error, netmgmt.EchoStats) {
+	return func(stan int, rtt time.Duration, err error, st netmgmt.EchoStats) {
+		cs.SetEcho(stan, st)
+		link.RecordEcho(err, rtt)
+		if err != nil {
+			log.Printf("echo STAN=%06d on %s failed: %v", stan, link.Name, err)
+			atomic.AddUint64(&cs.Errs, 1)
+			return
 		}
-	}()
+		log.Printf("echo STAN=%06d on %s answered in %s", stan, link.Name, rtt.Round(time.Millisecond))
+	}
+}
 
-	// graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-	<-c
-	close(stop)
-	conn.Close()
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	_ = adm.Shutdown(ctx)
-	log.Println("gateway stopped")
+// buildTLSOptions turns the -tls-* flags into transport options.
+func buildTLSOptions(endpoint, ca, cert, key, name, minVersion, ciphers, pins string, insecure bool) (*transport.TLSOptions, error) {
+	o := &transport.TLSOptions{
+		CAFile:             ca,
+		CertFile:           cert,
+		KeyFile:            key,
+		ServerName:         name,
+		InsecureSkipVerify: insecure,
+	}
+	var err error
+	if o.MinVersion, err = transport.ParseTLSVersion(minVersion); err != nil {
+		return nil, err
+	}
+	if o.CipherSuites, err = transport.ParseCipherSuites(ciphers); err != nil {
+		return nil, err
+	}
+	if pins != "" {
+		o.PinnedSPKI = strings.Split(pins, ",")
+	}
+	// Fail fast on unreadable files instead of on every reconnect.
+	if _, err := o.Config(endpoint); err != nil {
+		return nil, err
+	}
+	return o, nil
 }
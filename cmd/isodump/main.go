@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/iso8583/emv"
+)
+
+func main() {
+	specPath := flag.String("spec", "", "JSON field spec file (default: built-in common spec)")
+	charset := flag.String("charset", "", "override the spec's wire character set: ascii, cp037 (ebcdic) or cp500")
+	format := flag.String("format", "auto", "input encoding: auto, hex, base64 or raw")
+	skip := flag.Int("skip", 0, "bytes to skip before the MTI, e.g. 2 for an MLI or 7 for MLI and TPDU")
+	diff := flag.Bool("diff", false, "compare two messages field by field")
+	unmask := flag.Bool("unmask", false, "show cardholder data in clear")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: isodump [flags] [file]\n       isodump [flags] -diff a b\n\nFiles default to stdin; \"-\" also reads stdin.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	spec, err := iso8583.ResolveSpec(*specPath, *charset)
+	if err != nil {
+		log.Fatalf("spec: %v", err)
+	}
+	d := dumper{spec: spec, format: *format, skip: *skip, unmask: *unmask}
+
+	args := flag.Args()
+	if *diff {
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		a, aInvalid, err := d.load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, bInvalid, err := d.load(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		warnInvalid(args[0], aInvalid)
+		warnInvalid(args[1], bInvalid)
+		if !d.diff(os.Stdout, a, b) {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	name := "-"
+	if len(args) == 1 {
+		name = args[0]
+	}
+	m, invalid, err := d.load(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := d.dump(os.Stdout, m, invalid); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type dumper struct {
+	spec   *iso8583.Spec
+	format string
+	skip   int
+	unmask bool
+}
+
+// load reads, decodes and unpacks one message from name, "-" being stdin.
+// Fields that break their content class are still decoded; their errors
+// are returned by field.
+func (d *dumper) load(name string) (*iso8583.Message, map[int]error, error) {
+	var (
+		in  []byte
+		err error
+	)
+	if name == "-" {
+		in, err = io.ReadAll(os.Stdin)
+	} else {
+		in, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := decode(in, d.format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if d.skip > len(p) {
+		return nil, nil, fmt.Errorf("%s: %d bytes, cannot skip %d", name, len(p), d.skip)
+	}
+	m, fes, err := iso8583.UnpackLenient(d.spec, p[d.skip:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: unpack: %w", name, err)
+	}
+	invalid := make(map[int]error, len(fes))
+	for _, fe := range fes {
+		invalid[fe.Field] = fe.Err
+	}
+	return m, invalid, nil
+}
+
+// warnInvalid logs the content class errors of a message loaded from
+// name, for output that does not show them next to the fields.
+func warnInvalid(name string, invalid map[int]error) {
+	fields := make([]int, 0, len(invalid))
+	for f := range invalid {
+		fields = append(fields, f)
+	}
+	sort.Ints(fields)
+	for _, f := range fields {
+		log.Printf("%s: DE%d: %v", name, f, invalid[f])
+	}
+}
+
+// decode turns the input into wire bytes. In auto mode text that is all
+// hex digits is hex, otherwise valid base64 is base64, otherwise raw.
+func decode(in []byte, format string) ([]byte, error) {
+	text := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, string(in))
+	switch format {
+	case "hex":
+		return hex.DecodeString(text)
+	case "base64":
+		return base64.StdEncoding.DecodeString(text)
+	case "raw":
+		return in, nil
+	case "auto":
+		if b, err := hex.DecodeString(text); err == nil {
+			return b, nil
+		}
+		if b, err := base64.StdEncoding.DecodeString(text); err == nil && len(text) > 0 {
+			return b, nil
+		}
+		return in, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// value formats field f of m, or its MTI for field 0. Cardholder data is
+// masked unless -unmask is set, binary fields are shown as hex.
+func (d *dumper) value(m *iso8583.Message, f int) string {
+	if f == 0 {
+		return m.MTI
+	}
+	if !d.unmask {
+		return m.Redacted()[f]
+	}
+	v, _ := m.Value(d.spec, f)
+	return v.String()
+}
+
+func (d *dumper) label(f int) string {
+	if f == 0 {
+		return "MTI"
+	}
+	return fmt.Sprintf("DE%-3d %s", f, d.spec.Fields[f].Name)
+}
+
+// dump prints m field by field, with the content class error, if any,
+// under each field in invalid.
+func (d *dumper) dump(w io.Writer, m *iso8583.Message, invalid map[int]error) error {
+	bms, err := m.Bitmaps(d.spec)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "MTI      %s\n", m.MTI)
+	for i, v := range bms {
+		var set []string
+		for v != 0 {
+			n := bits.LeadingZeros64(v)
+			set = append(set, fmt.Sprint(i*64+n+1))
+			v &^= 1 << (63 - n)
+		}
+		fmt.Fprintf(w, "Bitmap %d %016X  %s\n", i+1, bms[i], strings.Join(set, " "))
+	}
+	nums := make([]int, 0, len(m.Fields))
+	for f := range m.Fields {
+		nums = append(nums, f)
+	}
+	sort.Ints(nums)
+	for _, f := range nums {
+		fmt.Fprintf(w, "%-28s [%s]\n", d.label(f), d.value(m, f))
+		if err := invalid[f]; err != nil {
+			fmt.Fprintf(w, "  (invalid: %v)\n", err)
+			continue
+		}
+		switch {
+		case f == 55:
+			d.dumpEMV(w, m)
+		case d.spec.Fields[f].Sub != nil:
+			d.dumpSubs(w, m, f)
+		}
+	}
+	return nil
+}
+
+// dumpSubs lists the sub-elements of field f, in layout order, then any
+// others (TLV tags the layout does not name) sorted.
+func (d *dumper) dumpSubs(w io.Writer, m *iso8583.Message, f int) {
+	if v, _ := m.Value(d.spec, f); !d.unmask && m.Redacted()[f] != v.String() {
+		return
+	}
+	subs, err := m.Subs(f)
+	if err != nil {
+		fmt.Fprintf(w, "  (%v)\n", err)
+		return
+	}
+	for _, sf := range d.spec.Fields[f].Sub.Fields {
+		if v, ok := subs[sf.ID]; ok {
+			fmt.Fprintf(w, "  %-6s %-19s [%s]\n", sf.ID, sf.Name, v)
+			delete(subs, sf.ID)
+		}
+	}
+	rest := make([]string, 0, len(subs))
+	for id := range subs {
+		rest = append(rest, id)
+	}
+	sort.Strings(rest)
+	for _, id := range rest {
+		fmt.Fprintf(w, "  %-6s %-19s [%s]\n", id, "", subs[id])
+	}
+}
+
+// dumpEMV lists the DE55 tags by name. Without -unmask nothing is listed
+// while DE55 itself is masked, and tags holding cardholder data stay
+// masked even when it is not.
+func (d *dumper) dumpEMV(w io.Writer, m *iso8583.Message) {
+	if v, _ := m.Value(d.spec, 55); !d.unmask && m.Redacted()[55] != v.String() {
+		return
+	}
+	v, _, err := m.GetBytes(d.spec, 55)
+	var list []emv.TLV
+	if err == nil {
+		list, err = emv.Decode(v)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "  (not BER-TLV: %v)\n", err)
+		return
+	}
+	for _, o := range list {
+		val := strings.ToUpper(hex.EncodeToString(o.Value))
+		if o.Tag.Sensitive() && !d.unmask {
+			val = "[redacted]"
+		}
+		fmt.Fprintf(w, "  %-6s %-19s [%s]\n", o.Tag, o.Tag.Name(), val)
+	}
+}
+
+// diff prints the differences between a and b, "-" lines for a and "+"
+// lines for b, and reports whether the messages are equal.
+func (d *dumper) diff(w io.Writer, a, b *iso8583.Message) bool {
+	diffs := iso8583.Diff(a, b)
+	for _, df := range diffs {
+		if df.InA {
+			fmt.Fprintf(w, "- %-28s [%s]\n", d.label(df.Field), d.value(a, df.Field))
+		}
+		if df.InB {
+			fmt.Fprintf(w, "+ %-28s [%s]\n", d.label(df.Field), d.value(b, df.Field))
+		}
+	}
+	return len(diffs) == 0
+}
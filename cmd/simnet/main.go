@@ -1,82 +1,85 @@
 package main
 
 import (
-	"bufio"
-	"encoding/binary"
+	"context"
 	"flag"
-	"io"
 	"log"
-	"net"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/sim"
+	"go-payment-gateway/internal/transport"
 )
 
 func main() {
 	listen := flag.String("listen", ":5001", "listen addr")
+	specPath := flag.String("spec", "", "JSON field spec file (default: built-in common spec)")
+	charset := flag.String("charset", "", "override the spec's wire character set: ascii, cp037 (ebcdic) or cp500")
+	mli := flag.String("mli", "2be", "message length indicator: 2be, 2le, 4be or 4ascii")
+	mliIncl := flag.Bool("mli-inclusive", false, "MLI counts its own bytes")
+	header := flag.String("header", "", "hex header after the MLI, e.g. a TPDU")
+	macAlg := flag.String("mac", "", "MAC algorithm overriding the spec's: x9.9, x9.19 or iso9797-alg3")
+	macKey := flag.String("mac-key", "", "hex MAC key; MACs responses and drops requests failing verification")
+	scenarioPath := flag.String("scenario", "", "JSON scenario rules (default: approve everything)")
+	fault := flag.String("fault", "none", "misbehave on every response: drop-mid-frame, truncated-mli, garbage, wrong-stan, duplicate or split-writes")
+	stall := flag.Duration("stall", 0, "block each session this long before answering a request")
+	closeAfter := flag.Int("close-after", 0, "close each connection after this many messages (0 never)")
 	flag.Parse()
 
-	ln, err := net.Listen("tcp", *listen)
+	spec, err := iso8583.ResolveSpec(*specPath, *charset)
 	if err != nil {
-		log.Fatalf("listen: %v", err)
+		log.Fatalf("spec: %v", err)
 	}
-	log.Printf("simnet listening on %s", *listen)
-	for {
-		c, err := ln.Accept()
-		if err != nil {
-			log.Printf("accept: %v", err)
-			continue
-		}
-		go handle(c)
+	if spec, err = iso8583.ResolveMAC(spec, *macAlg, *macKey); err != nil {
+		log.Fatalf("mac: %v", err)
+	}
+	framer, err := transport.NewFramer(*mli, *mliIncl, *header)
+	if err != nil {
+		log.Fatalf("framing: %v", err)
 	}
-}
 
-func handle(conn net.Conn) {
-	defer conn.Close()
-	log.Printf("client %s connected", conn.RemoteAddr())
-	reader := bufio.NewReader(conn)
-	for {
-		_ = conn.SetReadDeadline(time.Now().Add(120 * time.Second))
-		mliBytes := make([]byte, 2)
-		if _, err := io.ReadFull(reader, mliBytes); err != nil {
-			log.Printf("read mli: %v", err)
-			return
-		}
-		mli := int(binary.BigEndian.Uint16(mliBytes))
-		payload := make([]byte, mli)
-		if _, err := io.ReadFull(reader, payload); err != nil {
-			log.Printf("read payload: %v", err)
-			return
-		}
+	f, err := sim.ParseFault(*fault)
+	if err != nil {
+		log.Fatalf("fault: %v", err)
+	}
 
-		full := append(mliBytes, payload...)
-		msg, err := iso8583.Unpack(full)
-		if err != nil {
-			log.Printf("unpack: %v", err)
-			continue
+	var scenario *sim.Scenario
+	if *scenarioPath != "" {
+		if scenario, err = sim.LoadScenario(*scenarioPath); err != nil {
+			log.Fatalf("scenario: %v", err)
 		}
-		log.Printf("RX %s fields=%v", msg.MTI, msg.Fields)
+		log.Printf("playing %d rules from %s", len(scenario.Rules), *scenarioPath)
+	}
 
-		if msg.MTI == "0800" {
-			// Build 0810 response echoing STAN, DE70
-			r := iso8583.New("0810")
-			if v, ok := msg.Get(11); ok {
-				r.Set(11, v)
-			}
-			r.Set(7, time.Now().UTC().Format("0102150405"))
-			if v, ok := msg.Get(70); ok {
-				r.Set(70, v)
-			}
-			b, err := r.Pack()
-			if err != nil {
-				log.Printf("pack resp: %v", err)
-				continue
-			}
-			if _, err := conn.Write(b); err != nil {
-				log.Printf("write resp: %v", err)
-				return
-			}
-			log.Printf("TX 0810 echo resp STAN=%v", msg.Fields[11])
-		}
+	ln, err := sim.Listen(sim.Config{
+		Addr:     *listen,
+		Spec:     spec,
+		Framer:   framer,
+		Scenario: scenario,
+		ReadIdle: 120 * time.Second,
+
+		Fault:      f,
+		Stall:      *stall,
+		CloseAfter: *closeAfter,
+	})
+	if err != nil {
+		log.Fatalf("listen: %v", err)
 	}
+	log.Printf("simnet listening on %s", ln.Addr())
+	go func() {
+		if err := ln.Serve(); err != nil {
+			log.Fatalf("accept: %v", err)
+		}
+	}()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	<-c
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = ln.Shutdown(ctx)
+	log.Println("simnet stopped")
 }
@@ -3,30 +3,94 @@ package admin
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"go-payment-gateway/internal/journal"
+	"go-payment-gateway/internal/netmgmt"
+	"go-payment-gateway/internal/transport"
 )
 
+// ConnStat holds one link's admin view. The counters are updated with
+// sync/atomic; the other fields are written through the setters, which the
+// handlers serialise with Snapshot.
 type ConnStat struct {
-	Endpoint     string        `json:"endpoint"`
-	Up           bool          `json:"up"`
-	LastChangeTs time.Time     `json:"last_change_ts"`
-	LastEchoSTAN int           `json:"last_echo_stan"`
-	LastEchoAt   time.Time     `json:"last_echo_at"`
-	RxMsgs       uint64        `json:"rx_msgs"`
-	TxMsgs       uint64        `json:"tx_msgs"`
-	Errs         uint64        `json:"errs"`
+	mu sync.Mutex
+
+	Endpoint     string    `json:"endpoint"`
+	Up           bool      `json:"up"`
+	LastChangeTs time.Time `json:"last_change_ts"`
+	LastEchoSTAN int       `json:"last_echo_stan"`
+	LastEchoAt   time.Time `json:"last_echo_at"`
+	RxMsgs       uint64    `json:"rx_msgs"`
+	TxMsgs       uint64    `json:"tx_msgs"`
+	Errs         uint64    `json:"errs"`
+	Orphans      uint64    `json:"orphans"` // responses matching no pending request
+	MACFailures  uint64    `json:"mac_failures"`
+	// TLS is the handshake state while connected over TLS.
+	TLS *transport.TLSInfo `json:"tls,omitempty"`
+	// NetMgmt is the sign-on state, nil when sign-on is disabled.
+	NetMgmt *netmgmt.Status `json:"netmgmt,omitempty"`
+	// Echo holds echo test statistics once the first echo completed.
+	Echo *netmgmt.EchoStats `json:"echo,omitempty"`
+}
+
+// SetUp records a connect (with its TLS state, nil without TLS) or a
+// disconnect.
+func (c *ConnStat) SetUp(up bool, tls *transport.TLSInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Up, c.LastChangeTs, c.TLS = up, time.Now(), tls
+}
+
+// SetNetMgmt records the sign-on state.
+func (c *ConnStat) SetNetMgmt(s netmgmt.Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.NetMgmt = &s
+}
+
+// SetEcho records a completed echo test.
+func (c *ConnStat) SetEcho(stan int, st netmgmt.EchoStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.LastEchoSTAN, c.LastEchoAt, c.Echo = stan, time.Now(), &st
+}
+
+// Snapshot returns a consistent copy for the handlers.
+func (c *ConnStat) Snapshot() *ConnStat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &ConnStat{
+		Endpoint:     c.Endpoint,
+		Up:           c.Up,
+		LastChangeTs: c.LastChangeTs,
+		LastEchoSTAN: c.LastEchoSTAN,
+		LastEchoAt:   c.LastEchoAt,
+		RxMsgs:       atomic.LoadUint64(&c.RxMsgs),
+		TxMsgs:       atomic.LoadUint64(&c.TxMsgs),
+		Errs:         atomic.LoadUint64(&c.Errs),
+		Orphans:      atomic.LoadUint64(&c.Orphans),
+		MACFailures:  atomic.LoadUint64(&c.MACFailures),
+		TLS:          c.TLS,
+		NetMgmt:      c.NetMgmt,
+		Echo:         c.Echo,
+	}
 }
 
 type State struct {
 	Started time.Time `json:"started"`
-	// For demo we support a single upstream
-	Conn ConnStat `json:"conn"`
+	// Links holds one entry per upstream link, in configured order.
+	Links []*ConnStat `json:"links"`
 }
 
-func Serve(addr string, st *State) *http.Server {
+// Serve starts the admin server. j may be nil when journalling is off.
+func Serve(addr string, st *State, j *journal.Journal) *http.Server {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -38,16 +102,65 @@ func Serve(addr string, st *State) *http.Server {
 	})
 
 	mux.HandleFunc("/connections", func(w http.ResponseWriter, r *http.Request) {
+		links := make([]*ConnStat, len(st.Links))
+		for i, c := range st.Links {
+			links[i] = c.Snapshot()
+		}
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(st.Conn)
+		_ = json.NewEncoder(w).Encode(links)
+	})
+
+	mux.HandleFunc("/journal", func(w http.ResponseWriter, r *http.Request) {
+		if j == nil {
+			http.Error(w, "journal disabled", http.StatusNotFound)
+			return
+		}
+		q, err := parseJournalQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := j.Find(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(entries)
 	})
 
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "gateway_uptime_seconds %d\n", int(time.Since(st.Started).Seconds()))
-		fmt.Fprintf(w, "gateway_tx_messages_total %d\n", atomic.LoadUint64(&st.Conn.TxMsgs))
-		fmt.Fprintf(w, "gateway_rx_messages_total %d\n", atomic.LoadUint64(&st.Conn.RxMsgs))
-		fmt.Fprintf(w, "gateway_errors_total %d\n", atomic.LoadUint64(&st.Conn.Errs))
-		if st.Conn.Up { fmt.Fprintln(w, "gateway_up 1") } else { fmt.Fprintln(w, "gateway_up 0") }
+		for _, c := range st.Links {
+			c = c.Snapshot()
+			l := fmt.Sprintf("{link=%q}", c.Endpoint)
+			fmt.Fprintf(w, "gateway_tx_messages_total%s %d\n", l, c.TxMsgs)
+			fmt.Fprintf(w, "gateway_rx_messages_total%s %d\n", l, c.RxMsgs)
+			fmt.Fprintf(w, "gateway_errors_total%s %d\n", l, c.Errs)
+			fmt.Fprintf(w, "gateway_orphan_responses_total%s %d\n", l, c.Orphans)
+			fmt.Fprintf(w, "gateway_mac_failures_total%s %d\n", l, c.MACFailures)
+			if t := c.TLS; t != nil {
+				fmt.Fprintf(w, "gateway_tls_peer_cert_expiry_timestamp_seconds%s %d\n", l, t.PeerNotAfter.Unix())
+				if !t.ClientNotAfter.IsZero() {
+					fmt.Fprintf(w, "gateway_tls_client_cert_expiry_timestamp_seconds%s %d\n", l, t.ClientNotAfter.Unix())
+				}
+			}
+			if c.Up {
+				fmt.Fprintf(w, "gateway_up%s 1\n", l)
+			} else {
+				fmt.Fprintf(w, "gateway_up%s 0\n", l)
+			}
+			if n := c.NetMgmt; n != nil {
+				signedOn := 0
+				if n.State == netmgmt.StateSignedOn {
+					signedOn = 1
+				}
+				fmt.Fprintf(w, "gateway_signed_on%s %d\n", l, signedOn)
+			}
+			if e := c.Echo; e != nil {
+				writeEchoMetrics(w, c.Endpoint, e)
+			}
+		}
 	})
 
 	s := &http.Server{Addr: addr, Handler: mux}
@@ -59,3 +172,43 @@ func Serve(addr string, st *State) *http.Server {
 	}()
 	return s
 }
+
+func writeEchoMetrics(w io.Writer, link string, e *netmgmt.EchoStats) {
+	l := fmt.Sprintf("{link=%q}", link)
+	for i, b := range e.RTT.Bounds {
+		fmt.Fprintf(w, "gateway_echo_rtt_seconds_bucket{link=%q,le=\"%g\"} %d\n", link, b, e.RTT.Counts[i])
+	}
+	fmt.Fprintf(w, "gateway_echo_rtt_seconds_bucket{link=%q,le=\"+Inf\"} %d\n", link, e.RTT.Count)
+	fmt.Fprintf(w, "gateway_echo_rtt_seconds_sum%s %g\n", l, e.RTT.Sum)
+	fmt.Fprintf(w, "gateway_echo_rtt_seconds_count%s %d\n", l, e.RTT.Count)
+	fmt.Fprintf(w, "gateway_echo_missed_total%s %d\n", l, e.Missed)
+	fmt.Fprintf(w, "gateway_echo_outstanding%s %d\n", l, e.Outstanding)
+	degraded := 0
+	if e.Degraded {
+		degraded = 1
+	}
+	fmt.Fprintf(w, "gateway_link_degraded%s %d\n", l, degraded)
+}
+
+// parseJournalQuery reads stan, rrn, from and to (RFC 3339) and limit.
+func parseJournalQuery(r *http.Request) (journal.Query, error) {
+	v := r.URL.Query()
+	q := journal.Query{STAN: v.Get("stan"), RRN: v.Get("rrn")}
+	var err error
+	if s := v.Get("from"); s != "" {
+		if q.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("from: %w", err)
+		}
+	}
+	if s := v.Get("to"); s != "" {
+		if q.To, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("to: %w", err)
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			return q, fmt.Errorf("limit: %w", err)
+		}
+	}
+	return q, nil
+}
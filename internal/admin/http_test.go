@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/netmgmt"
+	"go-payment-gateway/internal/transport"
+)
+
+func TestHandlersSnapshotLinkState(t *testing.T) {
+	cs := &ConnStat{Endpoint: "host:1"}
+	st := &State{Started: time.Now(), Links: []*ConnStat{cs}}
+	srv := Serve("127.0.0.1:0", st, nil)
+	defer srv.Close()
+	h := srv.Handler
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			cs.SetUp(i%2 == 0, &transport.TLSInfo{Version: "TLS 1.3"})
+			cs.SetNetMgmt(netmgmt.Status{State: netmgmt.StateSignedOn})
+			cs.SetEcho(i, netmgmt.EchoStats{Missed: uint64(i)})
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		for _, path := range []string{"/connections", "/metrics"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: %d", path, w.Code)
+			}
+		}
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/connections", nil))
+	var got []map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil || len(got) != 1 || got[0]["up"] != false || got[0]["last_echo_stan"] != 199.0 {
+		t.Fatalf("connections = %v, %v", got, err)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `gateway_signed_on{link="host:1"} 1`) {
+		t.Fatalf("metrics:\n%s", w.Body)
+	}
+}
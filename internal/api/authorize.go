@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/transport"
+)
+
+// Exchanger sends a request upstream and waits for its response.
+type Exchanger interface {
+	SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error)
+}
+
+// AuthorizeRequest is the JSON body accepted by POST /v1/authorize.
+type AuthorizeRequest struct {
+	PAN      string `json:"pan"`
+	Amount   int64  `json:"amount"`   // minor units
+	Currency string `json:"currency"` // ISO 4217 numeric code, e.g. "840"
+	Terminal string `json:"terminal_id"`
+	Merchant string `json:"merchant_id"`
+	Expiry   string `json:"expiry,omitempty"` // YYMM
+	Type     string `json:"type,omitempty"`   // "purchase" (0200, default) or "auth" (0100)
+}
+
+// AuthorizeResponse carries the host's answer back to the caller.
+type AuthorizeResponse struct {
+	Approved     bool   `json:"approved"`
+	MTI          string `json:"mti"`
+	ResponseCode string `json:"response_code"`     // DE39
+	AuthID       string `json:"auth_id,omitempty"` // DE38
+	RRN          string `json:"rrn"`               // DE37
+	STAN         string `json:"stan"`              // DE11
+}
+
+// ErrorResponse is returned with any non-2xx status.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// Error codes returned in ErrorResponse.Error.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeUpstreamTimeout     = "upstream_timeout"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+)
+
+// Serve starts the merchant-facing HTTP API on addr, building messages
+// for spec. onTimeout, if set, is called with every request whose outcome
+// is unknown because the host did not answer in time or the wait was cut
+// short.
+func Serve(addr string, spec *iso8583.Spec, ex Exchanger, nextSTAN func() int, onTimeout func(*iso8583.Message)) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/authorize", &authorizeHandler{spec: spec, ex: ex, nextSTAN: nextSTAN, onTimeout: onTimeout})
+
+	s := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("api listening on %s", addr)
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("api server error: %v", err)
+		}
+	}()
+	return s
+}
+
+type authorizeHandler struct {
+	spec      *iso8583.Spec
+	ex        Exchanger
+	nextSTAN  func() int
+	onTimeout func(*iso8583.Message)
+}
+
+func (h *authorizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, CodeInvalidRequest, "use POST")
+		return
+	}
+	var req AuthorizeRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	m, err := BuildAuthorization(h.spec, req, h.nextSTAN(), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// The exchange outlives the client: once the request is on the wire its
+	// outcome must be settled, by a response or a reversal, even if the
+	// caller hangs up. The correlator's response timeout bounds the wait.
+	resp, err := h.ex.SendAndWait(context.WithoutCancel(r.Context()), m)
+	switch {
+	case errors.Is(err, transport.ErrTimeout), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		if h.onTimeout != nil {
+			h.onTimeout(m)
+		}
+		writeError(w, http.StatusGatewayTimeout, CodeUpstreamTimeout, "no response from host")
+		return
+	case errors.As(err, new(*iso8583.FieldError)):
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadGateway, CodeUpstreamUnavailable, err.Error())
+		return
+	}
+
+	out := AuthorizeResponse{MTI: resp.MTI}
+	out.ResponseCode, _ = resp.Get(39)
+	out.AuthID, _ = resp.Get(38)
+	out.RRN, _ = resp.Get(37)
+	out.STAN, _ = resp.Get(11)
+	out.Approved = out.ResponseCode == "00"
+	writeJSON(w, http.StatusOK, out)
+}
+
+// BuildAuthorization turns a JSON purchase into a 0100/0200 message, padding
+// fixed fields to their lengths in spec (DefaultSpec if nil).
+func BuildAuthorization(spec *iso8583.Spec, req AuthorizeRequest, stan int, now time.Time) (*iso8583.Message, error) {
+	mti := "0200"
+	switch req.Type {
+	case "", "purchase":
+	case "auth":
+		mti = "0100"
+	default:
+		return nil, fmt.Errorf("unknown type %q", req.Type)
+	}
+	if n := len(req.PAN); n < 12 || n > 19 || !isDigits(req.PAN) {
+		return nil, errors.New("pan must be 12-19 digits")
+	}
+	if req.Amount <= 0 || req.Amount > 999999999999 {
+		return nil, errors.New("amount out of range")
+	}
+	if len(req.Currency) != 3 || !isDigits(req.Currency) {
+		return nil, errors.New("currency must be a 3-digit ISO 4217 code")
+	}
+	// Maximum lengths of the IDs come from the spec via the setters.
+	if req.Terminal == "" {
+		return nil, errors.New("terminal_id is required")
+	}
+	if req.Merchant == "" {
+		return nil, errors.New("merchant_id is required")
+	}
+	if req.Expiry != "" && (len(req.Expiry) != 4 || !isDigits(req.Expiry)) {
+		return nil, errors.New("expiry must be YYMM")
+	}
+
+	m := iso8583.New(mti)
+	if spec != nil {
+		m.SetSpec(spec)
+	}
+	m.SetTransmissionTime(now)
+	m.SetSTAN(stan)
+	m.SetLocalTime(now)
+	if req.Expiry != "" {
+		m.Set(14, req.Expiry)
+	}
+	utc := now.UTC()
+	// RRN: last digit of year, julian day, hour, STAN.
+	rrn := fmt.Sprintf("%d%03d%02d%06d", utc.Year()%10, utc.YearDay(), utc.Hour(), stan%1000000)
+	for _, err := range []error{
+		m.SetPAN(req.PAN),
+		m.SetProcessingCode(iso8583.TxnPurchase, iso8583.AcctDefault, iso8583.AcctDefault),
+		m.SetAmount(req.Amount, req.Currency),
+		m.SetRRN(rrn),
+		m.SetTerminalID(req.Terminal),
+		m.SetMerchantID(req.Merchant),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: code, Message: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
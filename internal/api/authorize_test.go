@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+type exchangerFunc func(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error)
+
+func (f exchangerFunc) SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+	return f(ctx, m)
+}
+
+const testBody = `{"pan":"4111111111111111","amount":1000,"currency":"840","terminal_id":"TERM0001","merchant_id":"MERCHANT000001"}`
+
+func authorize(t *testing.T, ctx context.Context, ex Exchanger) (int, []*iso8583.Message) {
+	t.Helper()
+	var reversed []*iso8583.Message
+	h := &authorizeHandler{ex: ex, nextSTAN: func() int { return 1 }, onTimeout: func(m *iso8583.Message) { reversed = append(reversed, m) }}
+	r := httptest.NewRequest(http.MethodPost, "/v1/authorize", strings.NewReader(testBody)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, reversed
+}
+
+func TestClientGoneDoesNotCancelExchange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // client disconnected while the request was in flight
+	code, reversed := authorize(t, ctx, exchangerFunc(func(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("exchange context: %v", err)
+		}
+		resp := iso8583.New("0210")
+		resp.Set(39, "00")
+		return resp, nil
+	}))
+	if code != http.StatusOK || len(reversed) != 0 {
+		t.Fatalf("status %d, %d reversals", code, len(reversed))
+	}
+}
+
+func TestCanceledExchangeQueuesReversal(t *testing.T) {
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded} {
+		code, reversed := authorize(t, context.Background(), exchangerFunc(func(context.Context, *iso8583.Message) (*iso8583.Message, error) {
+			return nil, err
+		}))
+		if code != http.StatusGatewayTimeout || len(reversed) != 1 || reversed[0].MTI != "0200" {
+			t.Fatalf("%v: status %d, %d reversals", err, code, len(reversed))
+		}
+	}
+}
+
+func TestBuildAuthorizationUsesSpec(t *testing.T) {
+	spec := *iso8583.DefaultSpec
+	spec.Fields = maps.Clone(spec.Fields)
+	fs := spec.Fields[41]
+	fs.Len = 16
+	spec.Fields[41] = fs
+
+	req := AuthorizeRequest{PAN: "4111111111111111", Amount: 1000, Currency: "840", Terminal: "TERMINAL00000001", Merchant: "M1"}
+	if _, err := BuildAuthorization(nil, req, 1, time.Now()); err == nil {
+		t.Fatal("16-character terminal ID accepted by the default spec")
+	}
+	req.Terminal = "TERM0001"
+	m, err := BuildAuthorization(&spec, req, 1, time.Now())
+	if err != nil {
+		t.Fatalf("BuildAuthorization: %v", err)
+	}
+	if v, _ := m.Get(41); v != "TERM0001        " {
+		t.Fatalf("DE41 = %q, want padding to 16", v)
+	}
+	if _, err := m.Pack(&spec); err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+}
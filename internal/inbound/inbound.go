@@ -0,0 +1,86 @@
+// Package inbound dispatches host-initiated requests, such as an
+// acquirer's own 0800 echo tests, to handlers that build the reply.
+package inbound
+
+import (
+	"sync"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+// Handler answers one inbound request. A nil reply sends nothing.
+type Handler func(req *iso8583.Message) *iso8583.Message
+
+type key struct {
+	mti  string
+	code string // DE70, empty matches any
+}
+
+// Registry maps MTI and DE70 network management code to handlers.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[key]Handler
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[key]Handler)}
+}
+
+// NewDefaultRegistry returns a registry answering host echo (301), sign-on
+// (001) and cutover (201) requests with an approved 0810.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, code := range []string{"001", "201", "301"} {
+		r.Handle("0800", code, Approve)
+	}
+	return r
+}
+
+// Handle registers h for mti and DE70 code, replacing any previous handler.
+// An empty code matches requests without a more specific registration.
+func (r *Registry) Handle(mti, code string, h Handler) {
+	r.mu.Lock()
+	r.handlers[key{mti, code}] = h
+	r.mu.Unlock()
+}
+
+// Lookup finds the handler for req.
+func (r *Registry) Lookup(req *iso8583.Message) (Handler, bool) {
+	code, _ := req.Get(70)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if h, ok := r.handlers[key{req.MTI, code}]; ok {
+		return h, true
+	}
+	h, ok := r.handlers[key{req.MTI, ""}]
+	return h, ok
+}
+
+// Dispatch runs the handler for req. It reports false when none is
+// registered.
+func (r *Registry) Dispatch(req *iso8583.Message) (*iso8583.Message, bool) {
+	h, ok := r.Lookup(req)
+	if !ok {
+		return nil, false
+	}
+	return h(req), true
+}
+
+// Approve is a Handler replying with DE39=00.
+func Approve(req *iso8583.Message) *iso8583.Message {
+	return NetworkResponse(req, "00")
+}
+
+// NetworkResponse builds the 0810 answer to a network management request,
+// echoing DE7, DE11 and DE70.
+func NetworkResponse(req *iso8583.Message, rc string) *iso8583.Message {
+	r := iso8583.New(iso8583.ResponseMTI(req.MTI))
+	for _, f := range []int{7, 11, 70} {
+		if v, ok := req.Get(f); ok {
+			r.Set(f, v)
+		}
+	}
+	r.Set(39, rc)
+	return r
+}
@@ -0,0 +1,51 @@
+package inbound
+
+import (
+	"testing"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+func TestDefaultRegistryAnswersHostEcho(t *testing.T) {
+	r := NewDefaultRegistry()
+	req := iso8583.NewEchoRequest(123)
+	resp, ok := r.Dispatch(req)
+	if !ok {
+		t.Fatalf("echo not handled")
+	}
+	if resp.MTI != "0810" {
+		t.Fatalf("MTI %s", resp.MTI)
+	}
+	for _, f := range []int{7, 11, 70} {
+		want, _ := req.Get(f)
+		if got, _ := resp.Get(f); got != want {
+			t.Fatalf("DE%d = %q, want %q", f, got, want)
+		}
+	}
+	if rc, _ := resp.Get(39); rc != "00" {
+		t.Fatalf("DE39 = %q", rc)
+	}
+	if _, err := resp.Pack(iso8583.DefaultSpec); err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+
+	if _, ok := r.Dispatch(iso8583.NewNetworkRequest("161", 1)); ok {
+		t.Fatalf("161 should have no default handler")
+	}
+}
+
+func TestRegistryWildcardAndOverride(t *testing.T) {
+	r := NewDefaultRegistry()
+	r.Handle("0800", "", func(*iso8583.Message) *iso8583.Message { return nil })
+	if resp, ok := r.Dispatch(iso8583.NewNetworkRequest("161", 1)); !ok || resp != nil {
+		t.Fatalf("wildcard handler not used")
+	}
+	r.Handle("0800", "301", func(req *iso8583.Message) *iso8583.Message { return NetworkResponse(req, "96") })
+	resp, _ := r.Dispatch(iso8583.NewEchoRequest(1))
+	if rc, _ := resp.Get(39); rc != "96" {
+		t.Fatalf("override not used, DE39 = %q", rc)
+	}
+	if _, ok := r.Dispatch(iso8583.New("0200")); ok {
+		t.Fatalf("0200 should not be handled")
+	}
+}
@@ -0,0 +1,101 @@
+package iso8583
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// BitmapEncoding selects how each 64-bit bitmap is written on the wire.
+type BitmapEncoding int
+
+const (
+	BitmapBinary    BitmapEncoding = iota // 8 raw bytes
+	BitmapHex                             // 16 ASCII hex characters
+	BitmapEBCDICHex                       // 16 hex characters in EBCDIC
+)
+
+// bitmap holds the primary, secondary and tertiary bitmaps. Bit 1 flags
+// the secondary bitmap and, in specs that use one, bit 65 the tertiary.
+type bitmap [3]uint64
+
+func (bm *bitmap) set(bit int) { bm[(bit-1)/64] |= 1 << (63 - (bit-1)%64) }
+
+func (bm *bitmap) has(bit int) bool { return bm[(bit-1)/64]&(1<<(63-(bit-1)%64)) != 0 }
+
+func (e BitmapEncoding) size() int {
+	if e == BitmapBinary {
+		return 8
+	}
+	return 16
+}
+
+func (e BitmapEncoding) write(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	switch e {
+	case BitmapHex:
+		return append(buf, fmt.Sprintf("%016X", v)...)
+	case BitmapEBCDICHex:
+		return append(buf, CharsetCP037.Encode(fmt.Sprintf("%016X", v))...)
+	}
+	return append(buf, b[:]...)
+}
+
+func (e BitmapEncoding) read(p []byte, off *int) (uint64, error) {
+	n := e.size()
+	if *off+n > len(p) {
+		return 0, fmt.Errorf("truncated bitmap")
+	}
+	raw := p[*off : *off+n]
+	var (
+		v   uint64
+		err error
+	)
+	switch e {
+	case BitmapHex:
+		v, err = parseHexBitmap(string(raw))
+	case BitmapEBCDICHex:
+		v, err = parseHexBitmap(CharsetCP037.Decode(raw))
+	default:
+		v = binary.BigEndian.Uint64(raw)
+	}
+	if err != nil {
+		return 0, err
+	}
+	*off += n
+	return v, nil
+}
+
+func parseHexBitmap(s string) (uint64, error) {
+	if _, err := hex.DecodeString(s); err != nil {
+		return 0, fmt.Errorf("invalid hex bitmap %q", s)
+	}
+	return strconv.ParseUint(s, 16, 64)
+}
+
+var bitmapNames = map[BitmapEncoding]string{
+	BitmapBinary:    "binary",
+	BitmapHex:       "hex",
+	BitmapEBCDICHex: "ebcdic-hex",
+}
+
+func (e BitmapEncoding) String() string {
+	if n, ok := bitmapNames[e]; ok {
+		return n
+	}
+	return fmt.Sprintf("BitmapEncoding(%d)", int(e))
+}
+
+func (e BitmapEncoding) MarshalText() ([]byte, error) { return []byte(e.String()), nil }
+
+func (e *BitmapEncoding) UnmarshalText(b []byte) error {
+	for k, n := range bitmapNames {
+		if n == string(b) {
+			*e = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown bitmap encoding %q", b)
+}
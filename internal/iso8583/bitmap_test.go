@@ -0,0 +1,92 @@
+package iso8583
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func bitmapSpec(enc BitmapEncoding, tertiary bool) *Spec {
+	fields := map[int]FieldSpec{}
+	for f, fs := range CommonSpec {
+		fields[f] = fs
+	}
+	fields[130] = FieldSpec{Num: 130, Name: "Tertiary", Codec: FmtLLVAR}
+	return &Spec{Name: "bitmap", Fields: fields, Charset: CharsetASCII, Bitmap: enc, TertiaryBitmap: tertiary}
+}
+
+func TestHexBitmaps(t *testing.T) {
+	m := New("0800")
+	m.Set(7, "0102030405")
+	m.Set(11, "123456")
+	m.Set(70, "301")
+
+	for _, tc := range []struct {
+		enc  BitmapEncoding
+		want []byte
+	}{
+		{BitmapHex, []byte("82200000000000000400000000000000")},
+		{BitmapEBCDICHex, CharsetCP037.Encode("82200000000000000400000000000000")},
+	} {
+		spec := bitmapSpec(tc.enc, false)
+		p, err := m.Pack(spec)
+		if err != nil {
+			t.Fatalf("%v Pack: %v", tc.enc, err)
+		}
+		if got := p[4 : 4+32]; !bytes.Equal(got, tc.want) {
+			t.Fatalf("%v bitmaps = %q, want %q", tc.enc, got, tc.want)
+		}
+		m2, err := Unpack(spec, p)
+		if err != nil {
+			t.Fatalf("%v Unpack: %v", tc.enc, err)
+		}
+		if !reflect.DeepEqual(m.Fields, m2.Fields) {
+			t.Fatalf("%v roundtrip got %v", tc.enc, m2.Fields)
+		}
+	}
+}
+
+func TestInvalidHexBitmap(t *testing.T) {
+	spec := bitmapSpec(BitmapHex, false)
+	p, err := NewEchoRequest(1).Pack(spec)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	p[4] = 'G'
+	if _, err := Unpack(spec, p); err == nil || !strings.Contains(err.Error(), "bitmap") {
+		t.Fatalf("expected bitmap error, got %v", err)
+	}
+}
+
+func TestTertiaryBitmap(t *testing.T) {
+	m := New("0100")
+	m.Set(11, "000001")
+	m.Set(130, "THIRD")
+
+	if _, err := m.Pack(bitmapSpec(BitmapBinary, false)); err == nil {
+		t.Fatalf("expected field 130 to be rejected without tertiary bitmap")
+	}
+
+	spec := bitmapSpec(BitmapBinary, true)
+	p, err := m.Pack(spec)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	// primary + secondary (bit 65 set) + tertiary
+	if p[4]&0x80 == 0 || p[12]&0x80 == 0 {
+		t.Fatalf("secondary/tertiary indicators not set: % x", p[4:28])
+	}
+	m2, err := Unpack(spec, p)
+	if err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if !reflect.DeepEqual(m.Fields, m2.Fields) {
+		t.Fatalf("roundtrip got %v", m2.Fields)
+	}
+
+	m.Set(65, "X")
+	if _, err := m.Pack(spec); err == nil {
+		t.Fatalf("expected DE65 to be rejected with tertiary bitmap")
+	}
+}
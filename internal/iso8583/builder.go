@@ -0,0 +1,191 @@
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transaction types for the first two digits of DE3.
+const (
+	TxnPurchase    = "00"
+	TxnCashAdvance = "01"
+	TxnVoid        = "02"
+	TxnRefund      = "20"
+	TxnBalance     = "31"
+)
+
+// Account types for the "from" and "to" digits of DE3.
+const (
+	AcctDefault  = "00"
+	AcctSavings  = "10"
+	AcctChecking = "20"
+	AcctCredit   = "30"
+)
+
+// Field numbers used by the typed accessors.
+const (
+	fieldPAN      = 2
+	fieldProcCode = 3
+	fieldAmount   = 4
+	fieldTxnTime  = 7
+	fieldSTAN     = 11
+	fieldTime     = 12
+	fieldDate     = 13
+	fieldRRN      = 37
+	fieldTermID   = 41
+	fieldMerchID  = 42
+	fieldCurrency = 49
+)
+
+// SetFixed sets field f padded to its length in the message's spec:
+// numeric fields get leading zeros, others trailing spaces. Variable
+// fields are set as is. Values longer than the field are an error.
+func (m *Message) SetFixed(f int, v string) error {
+	fs, ok := m.Spec().Fields[f]
+	if !ok {
+		return &FieldError{Field: f, Err: errors.New("not in spec")}
+	}
+	switch fs.Codec {
+	case FmtFixedNum, FmtBCDNum:
+		v = padLeft(v, fs.Len, '0')
+	case FmtFixedAns:
+		if fs.Class == ClassN {
+			v = padLeft(v, fs.Len, '0')
+		} else {
+			v += strings.Repeat(" ", max(fs.Len-len(v), 0))
+		}
+	}
+	if fs.Len > 0 && len(v) > fs.Len {
+		return &FieldError{Field: f, Err: fmt.Errorf("%q longer than %d", v, fs.Len)}
+	}
+	if err := validateField(fs, v); err != nil {
+		return &FieldError{Field: f, Err: err}
+	}
+	m.Set(f, v)
+	return nil
+}
+
+func padLeft(v string, n int, c byte) string {
+	if len(v) >= n {
+		return v
+	}
+	return strings.Repeat(string(c), n-len(v)) + v
+}
+
+// SetPAN sets DE2 to a 12 to 19 digit card number.
+func (m *Message) SetPAN(pan string) error {
+	if n := len(pan); n < 12 || n > 19 || badChar(ClassN, pan) >= 0 {
+		return &FieldError{Field: fieldPAN, Err: errors.New("PAN must be 12-19 digits")}
+	}
+	return m.SetFixed(fieldPAN, pan)
+}
+
+// PAN returns DE2.
+func (m *Message) PAN() (string, bool) { return m.Get(fieldPAN) }
+
+// SetProcessingCode sets DE3 from a transaction type such as TxnPurchase
+// and the from and to account types.
+func (m *Message) SetProcessingCode(txnType, from, to string) error {
+	for _, p := range []string{txnType, from, to} {
+		if len(p) != 2 || badChar(ClassN, p) >= 0 {
+			return &FieldError{Field: fieldProcCode, Err: fmt.Errorf("%q is not 2 digits", p)}
+		}
+	}
+	return m.SetFixed(fieldProcCode, txnType+from+to)
+}
+
+// ProcessingCode splits DE3 into transaction type and account types.
+func (m *Message) ProcessingCode() (txnType, from, to string, err error) {
+	v, ok := m.Get(fieldProcCode)
+	if !ok || len(v) != 6 {
+		return "", "", "", &FieldError{Field: fieldProcCode, Err: fmt.Errorf("invalid processing code %q", v)}
+	}
+	return v[:2], v[2:4], v[4:], nil
+}
+
+// SetAmount sets DE4 in minor units and DE49 to the ISO 4217 currency.
+func (m *Message) SetAmount(minorUnits int64, currency string) error {
+	if minorUnits < 0 {
+		return &FieldError{Field: fieldAmount, Err: errors.New("negative amount")}
+	}
+	if err := m.SetFixed(fieldAmount, strconv.FormatInt(minorUnits, 10)); err != nil {
+		return err
+	}
+	return m.SetFixed(fieldCurrency, currency)
+}
+
+// Amount returns DE4 in minor units and the DE49 currency, "" if absent.
+func (m *Message) Amount() (int64, string, error) {
+	v, ok := m.Get(fieldAmount)
+	if !ok {
+		return 0, "", &FieldError{Field: fieldAmount, Err: errors.New("missing")}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, "", &FieldError{Field: fieldAmount, Err: fmt.Errorf("invalid amount %q", v)}
+	}
+	cur, _ := m.Get(fieldCurrency)
+	return n, strings.TrimSpace(cur), nil
+}
+
+// SetTransmissionTime sets DE7 to t in UTC as MMDDhhmmss.
+func (m *Message) SetTransmissionTime(t time.Time) {
+	m.Set(fieldTxnTime, t.UTC().Format("0102150405"))
+}
+
+// TransmissionTime parses DE7. DE7 has no year; the one placing it
+// closest to now is used.
+func (m *Message) TransmissionTime() (time.Time, error) {
+	v, _ := m.Get(fieldTxnTime)
+	t, err := time.Parse("0102150405", v)
+	if err != nil {
+		return time.Time{}, &FieldError{Field: fieldTxnTime, Err: fmt.Errorf("invalid time %q", v)}
+	}
+	return nearestYear(t, time.Now().UTC()), nil
+}
+
+// nearestYear moves t, parsed without a year, to the year that puts it
+// within six months of ref.
+func nearestYear(t, ref time.Time) time.Time {
+	t = t.AddDate(ref.Year()-t.Year(), 0, 0)
+	switch d := t.Sub(ref); {
+	case d > 183*24*time.Hour:
+		t = t.AddDate(-1, 0, 0)
+	case d < -183*24*time.Hour:
+		t = t.AddDate(1, 0, 0)
+	}
+	return t
+}
+
+// SetLocalTime sets DE12 (hhmmss) and DE13 (MMDD) from t as given.
+func (m *Message) SetLocalTime(t time.Time) {
+	m.Set(fieldTime, t.Format("150405"))
+	m.Set(fieldDate, t.Format("0102"))
+}
+
+// SetSTAN sets DE11, wrapping at one million.
+func (m *Message) SetSTAN(stan int) {
+	m.Set(fieldSTAN, fmt.Sprintf("%06d", stan%1000000))
+}
+
+// STAN parses DE11.
+func (m *Message) STAN() (int, error) {
+	v, _ := m.Get(fieldSTAN)
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &FieldError{Field: fieldSTAN, Err: fmt.Errorf("invalid STAN %q", v)}
+	}
+	return n, nil
+}
+
+// SetRRN sets DE37, padded as its spec requires.
+func (m *Message) SetRRN(rrn string) error { return m.SetFixed(fieldRRN, rrn) }
+
+// SetTerminalID sets DE41, space padded.
+func (m *Message) SetTerminalID(id string) error { return m.SetFixed(fieldTermID, id) }
+
+// SetMerchantID sets DE42, space padded.
+func (m *Message) SetMerchantID(id string) error { return m.SetFixed(fieldMerchID, id) }
@@ -0,0 +1,115 @@
+package iso8583
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBuilderPadsPerSpec(t *testing.T) {
+	m := New("0200")
+	if err := m.SetAmount(1000, "840"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetProcessingCode(TxnRefund, AcctChecking, AcctDefault); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetTerminalID("T1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetPAN("4111111111111111"); err != nil {
+		t.Fatal(err)
+	}
+	m.SetSTAN(1234567)
+	for f, want := range map[int]string{
+		2:  "4111111111111111",
+		3:  "202000",
+		4:  "000000001000",
+		11: "234567",
+		41: "T1      ",
+		49: "840",
+	} {
+		if v, _ := m.Get(f); v != want {
+			t.Errorf("DE%d = %q, want %q", f, v, want)
+		}
+	}
+	if _, err := m.Pack(DefaultSpec); err != nil {
+		t.Fatal(err)
+	}
+
+	amt, cur, err := m.Amount()
+	if err != nil || amt != 1000 || cur != "840" {
+		t.Fatalf("Amount = %d, %q, %v", amt, cur, err)
+	}
+	txn, from, to, err := m.ProcessingCode()
+	if err != nil || txn != TxnRefund || from != AcctChecking || to != AcctDefault {
+		t.Fatalf("ProcessingCode = %s %s %s, %v", txn, from, to, err)
+	}
+	if stan, err := m.STAN(); err != nil || stan != 234567 {
+		t.Fatalf("STAN = %d, %v", stan, err)
+	}
+}
+
+func TestBuilderPadsBCDSpec(t *testing.T) {
+	spec, err := LoadSpec("../../specs/bcd-switch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New("0200")
+	m.SetSpec(spec)
+	if err := m.SetAmount(5, "978"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get(4); v != "000000000005" {
+		t.Fatalf("DE4 = %q", v)
+	}
+	if _, err := m.Pack(spec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	m := New("0200")
+	var fe *FieldError
+	if err := m.SetAmount(1e12, "840"); !errors.As(err, &fe) || fe.Field != 4 {
+		t.Errorf("SetAmount overflow: %v", err)
+	}
+	if err := m.SetAmount(-1, "840"); err == nil {
+		t.Error("SetAmount accepted negative amount")
+	}
+	if err := m.SetPAN("4111-1111"); !errors.As(err, &fe) || fe.Field != 2 {
+		t.Errorf("SetPAN: %v", err)
+	}
+	if err := m.SetProcessingCode("0", "00", "00"); err == nil {
+		t.Error("SetProcessingCode accepted short type")
+	}
+	if err := m.SetTerminalID("TERMINAL1"); err == nil {
+		t.Error("SetTerminalID accepted 9 characters")
+	}
+	if _, _, err := m.Amount(); err == nil {
+		t.Error("Amount on message without DE4")
+	}
+}
+
+func TestTransmissionTime(t *testing.T) {
+	at := time.Date(2026, 10, 16, 7, 15, 31, 0, time.UTC)
+	m := New("0800")
+	m.SetTransmissionTime(at.In(time.FixedZone("X", 3600)))
+	if v, _ := m.Get(7); v != "1016071531" {
+		t.Fatalf("DE7 = %q", v)
+	}
+
+	parsed := time.Date(0, 12, 31, 23, 59, 0, 0, time.UTC)
+	ref := time.Date(2027, 1, 1, 0, 1, 0, 0, time.UTC)
+	if got := nearestYear(parsed, ref); got.Year() != 2026 {
+		t.Fatalf("nearestYear = %v, want 2026", got)
+	}
+	parsed = time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	ref = time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC)
+	if got := nearestYear(parsed, ref); got.Year() != 2027 {
+		t.Fatalf("nearestYear = %v, want 2027", got)
+	}
+	if got, err := m.TransmissionTime(); err != nil || got.Month() != 10 || got.Day() != 16 {
+		t.Fatalf("TransmissionTime = %v, %v", got, err)
+	}
+}
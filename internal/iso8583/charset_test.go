@@ -0,0 +1,92 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCharsetEncodeDecode(t *testing.T) {
+	if got := CharsetCP037.Encode("0800 AZaz"); !bytes.Equal(got, []byte{0xf0, 0xf8, 0xf0, 0xf0, 0x40, 0xc1, 0xe9, 0x81, 0xa9}) {
+		t.Fatalf("cp037 encode got % x", got)
+	}
+	// '[' and ']' are where cp037 and cp500 differ.
+	if CharsetCP037.Encode("[")[0] == CharsetCP500.Encode("[")[0] {
+		t.Fatalf("cp037 and cp500 should differ for '['")
+	}
+	for _, cs := range []Charset{CharsetASCII, CharsetCP037, CharsetCP500} {
+		all := make([]byte, 256)
+		for i := range all {
+			all[i] = byte(i)
+		}
+		if got := cs.Decode(cs.Encode(string(all))); got != string(all) {
+			t.Fatalf("%v does not round-trip", cs)
+		}
+	}
+	if c, err := ParseCharset("ebcdic"); err != nil || c != CharsetCP037 {
+		t.Fatalf("ParseCharset(ebcdic) = %v, %v", c, err)
+	}
+	if _, err := ParseCharset("utf16"); err == nil {
+		t.Fatalf("expected unknown charset error")
+	}
+}
+
+func TestMessageEBCDIC(t *testing.T) {
+	spec := &Spec{Name: "ebcdic", Fields: CommonSpec, Charset: CharsetCP037}
+
+	m := New("0800")
+	m.Set(7, "0102030405")
+	m.Set(11, "123456")
+	m.Set(48, "HELLO")
+	m.Set(70, "301")
+
+	packed, err := m.Pack(spec)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	if !bytes.Equal(packed[:4], []byte{0xf0, 0xf8, 0xf0, 0xf0}) {
+		t.Fatalf("MTI not EBCDIC: % x", packed[:4])
+	}
+	if !bytes.Contains(packed, CharsetCP037.Encode("005HELLO")) {
+		t.Fatalf("DE48 length header or data not EBCDIC: % x", packed)
+	}
+	if bytes.Contains(packed, []byte("HELLO")) {
+		t.Fatalf("ASCII data leaked into EBCDIC message")
+	}
+
+	m2, err := Unpack(spec, packed)
+	if err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if m2.MTI != "0800" {
+		t.Fatalf("MTI roundtrip got %q", m2.MTI)
+	}
+	for f, want := range m.Fields {
+		if got, _ := m2.Get(f); got != want {
+			t.Fatalf("DE%d roundtrip got %q want %q", f, got, want)
+		}
+	}
+}
+
+func TestClassBNotTranscoded(t *testing.T) {
+	spec := &Spec{Name: "ebcdic", Fields: CommonSpec, Charset: CharsetCP037}
+	tlv := "\x9f\x26\x02\x01\x02"
+
+	m := New("0100")
+	m.Set(55, tlv)
+	packed, err := m.Pack(spec)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	// EBCDIC length header, then the TLV bytes untouched.
+	want := append(CharsetCP037.Encode("005"), tlv...)
+	if !bytes.HasSuffix(packed, want) {
+		t.Fatalf("DE55 on the wire % x, want suffix % x", packed, want)
+	}
+	m2, err := Unpack(spec, packed)
+	if err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if got, _ := m2.Get(55); got != tlv {
+		t.Fatalf("DE55 roundtrip got % x", got)
+	}
+}
@@ -0,0 +1,283 @@
+package iso8583
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type prefixEnc int
+
+const (
+	prefixASCII  prefixEnc = iota // decimal digits as characters
+	prefixBCD                     // decimal digits packed two per byte
+	prefixBinary                  // unsigned big-endian integer
+)
+
+// lenPrefix describes the length header of a variable-length field.
+type lenPrefix struct {
+	name  string // LLVAR or LLLVAR, used in errors
+	enc   prefixEnc
+	size  int // header bytes on the wire
+	limit int // largest length the header can express
+}
+
+var (
+	asciiLL  = lenPrefix{"LLVAR", prefixASCII, 2, 99}
+	asciiLLL = lenPrefix{"LLLVAR", prefixASCII, 3, 999}
+	bcdLL    = lenPrefix{"LLVAR", prefixBCD, 1, 99}
+	bcdLLL   = lenPrefix{"LLLVAR", prefixBCD, 2, 999}
+	binLL    = lenPrefix{"LLVAR", prefixBinary, 1, 0xff}
+	binLLL   = lenPrefix{"LLLVAR", prefixBinary, 2, 0xffff}
+)
+
+// prefixFor returns the length header used by a variable-length codec.
+func prefixFor(c FieldCodec) (lenPrefix, bool) {
+	switch c {
+	case FmtLLVAR:
+		return asciiLL, true
+	case FmtLLLVAR:
+		return asciiLLL, true
+	case FmtBCDLLVAR, FmtBCDLLNum:
+		return bcdLL, true
+	case FmtBCDLLLVAR, FmtBCDLLLNum:
+		return bcdLLL, true
+	case FmtBinLLVAR:
+		return binLL, true
+	case FmtBinLLLVAR:
+		return binLLL, true
+	}
+	return lenPrefix{}, false
+}
+
+func (p lenPrefix) put(buf *bytes.Buffer, n int, cs Charset) {
+	switch p.enc {
+	case prefixASCII:
+		buf.Write(cs.Encode(fmt.Sprintf("%0*d", p.size, n)))
+	case prefixBCD:
+		b, _ := packBCD(fmt.Sprintf("%0*d", p.size*2, n), PadLeft)
+		buf.Write(b)
+	case prefixBinary:
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		buf.Write(b[2-p.size:])
+	}
+}
+
+func (p lenPrefix) read(b []byte, off *int, cs Charset) (int, error) {
+	if *off+p.size > len(b) {
+		return 0, fmt.Errorf("truncated %s length", p.name)
+	}
+	h := b[*off : *off+p.size]
+	var (
+		l   int
+		err error
+	)
+	switch p.enc {
+	case prefixASCII:
+		l, err = strconv.Atoi(cs.Decode(h))
+	case prefixBCD:
+		l, err = strconv.Atoi(unpackBCD(h, p.size*2, PadLeft))
+	case prefixBinary:
+		for _, c := range h {
+			l = l<<8 | int(c)
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s length: %w", p.name, err)
+	}
+	*off += p.size
+	return l, nil
+}
+
+// packVar writes v prefixed with its length. max, if non-zero, caps the
+// length below the prefix limit. cs encodes ASCII headers, data the value.
+func packVar(buf *bytes.Buffer, p lenPrefix, v string, max int, cs, data Charset) error {
+	if max <= 0 || max > p.limit {
+		max = p.limit
+	}
+	if len(v) > max {
+		return fmt.Errorf("value too long for %s: %d", p.name, len(v))
+	}
+	p.put(buf, len(v), cs)
+	buf.Write(data.Encode(v))
+	return nil
+}
+
+// unpackVar reads a length-prefixed value starting at *off in b and
+// advances *off. cs decodes ASCII headers, data the value.
+func unpackVar(b []byte, off *int, p lenPrefix, max int, cs, data Charset) (string, error) {
+	l, err := p.read(b, off, cs)
+	if err != nil {
+		return "", err
+	}
+	if max > 0 && l > max {
+		return "", fmt.Errorf("%s length %d exceeds max %d", p.name, l, max)
+	}
+	if *off+l > len(b) {
+		return "", fmt.Errorf("truncated %s value", p.name)
+	}
+	v := data.Decode(b[*off : *off+l])
+	*off += l
+	return v, nil
+}
+
+// packBCDVar writes the digit string v as packed BCD, prefixed with its
+// length in digits. Odd lengths get a filler nibble as selected by pad.
+func packBCDVar(buf *bytes.Buffer, p lenPrefix, v string, max int, pad Padding) error {
+	if max <= 0 || max > p.limit {
+		max = p.limit
+	}
+	if len(v) > max {
+		return fmt.Errorf("value too long for %s: %d", p.name, len(v))
+	}
+	b, err := packBCD(v, pad)
+	if err != nil {
+		return err
+	}
+	p.put(buf, len(v), CharsetASCII)
+	buf.Write(b)
+	return nil
+}
+
+// unpackBCDVar reads a value written by packBCDVar.
+func unpackBCDVar(b []byte, off *int, p lenPrefix, max int, pad Padding) (string, error) {
+	l, err := p.read(b, off, CharsetASCII)
+	if err != nil {
+		return "", err
+	}
+	if max > 0 && l > max {
+		return "", fmt.Errorf("%s length %d exceeds max %d", p.name, l, max)
+	}
+	n := bcdLen(l)
+	if *off+n > len(b) {
+		return "", fmt.Errorf("truncated %s value", p.name)
+	}
+	v := unpackBCD(b[*off:*off+n], l, pad)
+	*off += n
+	return v, nil
+}
+
+// packBCD packs a digit string two digits per byte. Odd lengths get a zero
+// filler nibble on the side selected by pad.
+func packBCD(v string, pad Padding) ([]byte, error) {
+	for i := 0; i < len(v); i++ {
+		if v[i] < '0' || v[i] > '9' {
+			return nil, fmt.Errorf("non-digit %q in BCD value", v[i])
+		}
+	}
+	if len(v)%2 != 0 {
+		if pad == PadRight {
+			v += "0"
+		} else {
+			v = "0" + v
+		}
+	}
+	out := make([]byte, len(v)/2)
+	for i := range out {
+		out[i] = (v[2*i]-'0')<<4 | (v[2*i+1] - '0')
+	}
+	return out, nil
+}
+
+// unpackBCD decodes n digits from b, dropping the filler nibble of odd
+// lengths.
+func unpackBCD(b []byte, n int, pad Padding) string {
+	const digits = "0123456789ABCDEF"
+	s := make([]byte, 0, len(b)*2)
+	for _, c := range b {
+		s = append(s, digits[c>>4], digits[c&0x0f])
+	}
+	if len(s) > n {
+		if pad == PadRight {
+			s = s[:n]
+		} else {
+			s = s[len(s)-n:]
+		}
+	}
+	return string(s)
+}
+
+// bcdLen is the number of bytes needed to pack n digits.
+func bcdLen(n int) int { return (n + 1) / 2 }
+
+// rawData reports whether a codec carries bytes that are never transcoded.
+func rawData(c FieldCodec) bool {
+	return c == FmtBinary || c == FmtBinLLVAR || c == FmtBinLLLVAR
+}
+
+// dataCharset returns the encoding of the value of field spec: none for
+// binary codecs and ClassB data, which are never transcoded, else cs.
+func dataCharset(spec FieldSpec, cs Charset) Charset {
+	if rawData(spec.Codec) || spec.Class == ClassB {
+		return CharsetASCII
+	}
+	return cs
+}
+
+// packField appends the wire form of v according to spec. Character data
+// and length headers are encoded with cs; BCD, binary and ClassB data are
+// written as is.
+func packField(buf *bytes.Buffer, spec FieldSpec, v string, cs Charset) error {
+	data := dataCharset(spec, cs)
+	switch spec.Codec {
+	case FmtFixedNum, FmtFixedAns, FmtBinary:
+		if len(v) != spec.Len {
+			return fmt.Errorf("must be %d characters, got %d", spec.Len, len(v))
+		}
+		buf.Write(data.Encode(v))
+	case FmtBCDNum:
+		if len(v) != spec.Len {
+			return fmt.Errorf("must be %d digits, got %d", spec.Len, len(v))
+		}
+		b, err := packBCD(v, spec.Pad)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	case FmtBCDLLNum, FmtBCDLLLNum:
+		p, _ := prefixFor(spec.Codec)
+		return packBCDVar(buf, p, v, spec.MaxLen, spec.Pad)
+	default:
+		p, ok := prefixFor(spec.Codec)
+		if !ok {
+			return errors.New("unknown codec")
+		}
+		return packVar(buf, p, v, spec.MaxLen, cs, data)
+	}
+	return nil
+}
+
+// unpackField reads one field according to spec starting at *off in b and
+// advances *off. Character data and length headers are decoded from cs.
+func unpackField(b []byte, off *int, spec FieldSpec, cs Charset) (string, error) {
+	data := dataCharset(spec, cs)
+	switch spec.Codec {
+	case FmtFixedNum, FmtFixedAns, FmtBinary:
+		if *off+spec.Len > len(b) {
+			return "", errors.New("truncated")
+		}
+		v := data.Decode(b[*off : *off+spec.Len])
+		*off += spec.Len
+		return v, nil
+	case FmtBCDNum:
+		n := bcdLen(spec.Len)
+		if *off+n > len(b) {
+			return "", errors.New("truncated")
+		}
+		v := unpackBCD(b[*off:*off+n], spec.Len, spec.Pad)
+		*off += n
+		return v, nil
+	case FmtBCDLLNum, FmtBCDLLLNum:
+		p, _ := prefixFor(spec.Codec)
+		return unpackBCDVar(b, off, p, spec.MaxLen, spec.Pad)
+	default:
+		p, ok := prefixFor(spec.Codec)
+		if !ok {
+			return "", errors.New("unknown codec")
+		}
+		return unpackVar(b, off, p, spec.MaxLen, cs, data)
+	}
+}
@@ -0,0 +1,111 @@
+package iso8583
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFieldCodecRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		spec FieldSpec
+		in   string
+		wire []byte
+	}{
+		{"bcd even", FieldSpec{Codec: FmtBCDNum, Len: 6}, "123456", []byte{0x12, 0x34, 0x56}},
+		{"bcd odd left", FieldSpec{Codec: FmtBCDNum, Len: 3}, "301", []byte{0x03, 0x01}},
+		{"bcd odd right", FieldSpec{Codec: FmtBCDNum, Len: 3, Pad: PadRight}, "301", []byte{0x30, 0x10}},
+		{"binary", FieldSpec{Codec: FmtBinary, Len: 4}, "\x00\xff\x10\x7f", []byte{0x00, 0xff, 0x10, 0x7f}},
+		{"bcd llvar", FieldSpec{Codec: FmtBCDLLVAR}, "HELLO", append([]byte{0x05}, "HELLO"...)},
+		{"bcd lllvar", FieldSpec{Codec: FmtBCDLLLVAR}, strings.Repeat("A", 123), append([]byte{0x01, 0x23}, strings.Repeat("A", 123)...)},
+		{"bcd llnum odd", FieldSpec{Codec: FmtBCDLLNum}, "4111111111111111111", []byte{0x19, 0x04, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11}},
+		{"bcd llnum odd right", FieldSpec{Codec: FmtBCDLLNum, Pad: PadRight}, "123", []byte{0x03, 0x12, 0x30}},
+		{"bcd lllnum", FieldSpec{Codec: FmtBCDLLLNum}, "1234", []byte{0x00, 0x04, 0x12, 0x34}},
+		{"bin llvar", FieldSpec{Codec: FmtBinLLVAR}, "\x01\x02", []byte{0x02, 0x01, 0x02}},
+		{"bin lllvar", FieldSpec{Codec: FmtBinLLLVAR}, strings.Repeat("B", 300), append([]byte{0x01, 0x2c}, strings.Repeat("B", 300)...)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := packField(&buf, tc.spec, tc.in, CharsetASCII); err != nil {
+				t.Fatalf("packField: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tc.wire) {
+				t.Fatalf("packed % x, want % x", buf.Bytes(), tc.wire)
+			}
+			off := 0
+			v, err := unpackField(buf.Bytes(), &off, tc.spec, CharsetASCII)
+			if err != nil {
+				t.Fatalf("unpackField: %v", err)
+			}
+			if v != tc.in || off != buf.Len() {
+				t.Fatalf("unpackField got %q off %d", v, off)
+			}
+		})
+	}
+}
+
+func TestFieldCodecErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := packField(&buf, FieldSpec{Codec: FmtBCDNum, Len: 4}, "12A4", CharsetASCII); err == nil {
+		t.Fatalf("expected non-digit error")
+	}
+	if err := packField(&buf, FieldSpec{Codec: FmtBinLLVAR}, strings.Repeat("x", 256), CharsetASCII); err == nil {
+		t.Fatalf("expected binary LLVAR length error")
+	}
+	if err := packField(&buf, FieldSpec{Codec: FmtBCDLLVAR, MaxLen: 4}, "HELLO", CharsetASCII); err == nil {
+		t.Fatalf("expected MaxLen error")
+	}
+	if err := packField(&buf, FieldSpec{Codec: FmtBCDLLNum}, "12=4", CharsetASCII); err == nil {
+		t.Fatalf("expected non-digit error for bcd-llnum")
+	}
+	off := 0
+	if _, err := unpackField([]byte{0x05, 0x12, 0x34}, &off, FieldSpec{Codec: FmtBCDLLNum}, CharsetASCII); err == nil {
+		t.Fatalf("expected truncated bcd-llnum value error")
+	}
+	off = 0
+	if _, err := unpackField([]byte{0x09, 'A'}, &off, FieldSpec{Codec: FmtBinLLVAR}, CharsetASCII); err == nil {
+		t.Fatalf("expected truncated value error")
+	}
+	off = 0
+	if _, err := unpackField([]byte{0x1a, 'A'}, &off, FieldSpec{Codec: FmtBCDLLVAR}, CharsetASCII); err == nil {
+		t.Fatalf("expected invalid BCD length error")
+	}
+}
+
+func TestMessageWithBinaryAndBCDFields(t *testing.T) {
+	spec := &Spec{Name: "bcd", Charset: CharsetASCII, Fields: map[int]FieldSpec{
+		2:  {Num: 2, Name: "PAN", Codec: FmtBCDLLVAR},
+		3:  {Num: 3, Name: "ProcessingCode", Codec: FmtBCDNum, Len: 6},
+		11: {Num: 11, Name: "STAN", Codec: FmtFixedNum, Len: 6},
+		22: {Num: 22, Name: "POSEntryMode", Codec: FmtBCDNum, Len: 3, Pad: PadRight},
+		52: {Num: 52, Name: "PINBlock", Codec: FmtBinary, Len: 8},
+		55: {Num: 55, Name: "ICCData", Codec: FmtBinLLLVAR},
+	}}
+
+	m := New("0200")
+	m.Set(2, "4111111111111111")
+	m.Set(3, "000000")
+	m.Set(11, "000001")
+	m.Set(22, "051")
+	m.Set(52, "\x01\x23\x45\x67\x89\xab\xcd\xef")
+	m.Set(55, "\x9f\x26\x08\x00\x00\x00\x00\x00\x00\x00\x00")
+
+	packed, err := m.Pack(spec)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	if !bytes.Contains(packed, []byte{0x00, 0x00, 0x00}) {
+		t.Fatalf("DE3 not BCD packed: % x", packed)
+	}
+	m2, err := Unpack(spec, packed)
+	if err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	for f, want := range m.Fields {
+		if got, _ := m2.Get(f); got != want {
+			t.Fatalf("DE%d roundtrip got %q want %q", f, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package iso8583
+
+import "sort"
+
+// FieldDiff is a field that differs between two messages. Field 0 stands
+// for the MTI.
+type FieldDiff struct {
+	Field    int
+	A, B     string
+	InA, InB bool
+}
+
+// Diff compares a and b field by field and returns the differences in
+// field order. Values are compared as is; callers showing them should
+// mask cardholder data first.
+func Diff(a, b *Message) []FieldDiff {
+	var out []FieldDiff
+	if a.MTI != b.MTI {
+		out = append(out, FieldDiff{Field: 0, A: a.MTI, B: b.MTI, InA: true, InB: true})
+	}
+	nums := make(map[int]bool, len(a.Fields)+len(b.Fields))
+	for f := range a.Fields {
+		nums[f] = true
+	}
+	for f := range b.Fields {
+		nums[f] = true
+	}
+	fields := make([]int, 0, len(nums))
+	for f := range nums {
+		fields = append(fields, f)
+	}
+	sort.Ints(fields)
+	for _, f := range fields {
+		va, inA := a.Get(f)
+		vb, inB := b.Get(f)
+		if inA != inB || va != vb {
+			out = append(out, FieldDiff{Field: f, A: va, B: vb, InA: inA, InB: inB})
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package iso8583
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := New("0200")
+	a.Set(3, "000000")
+	a.Set(4, "000000001000")
+	a.Set(11, "000123")
+	b := New("0210")
+	b.Set(3, "000000")
+	b.Set(4, "000000002000")
+	b.Set(39, "00")
+
+	want := []FieldDiff{
+		{Field: 0, A: "0200", B: "0210", InA: true, InB: true},
+		{Field: 4, A: "000000001000", B: "000000002000", InA: true, InB: true},
+		{Field: 11, A: "000123", InA: true},
+		{Field: 39, B: "00", InB: true},
+	}
+	if got := Diff(a, b); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff = %+v, want %+v", got, want)
+	}
+	if got := Diff(a, a); len(got) != 0 {
+		t.Fatalf("Diff(a, a) = %+v", got)
+	}
+}
+
+func TestBitmaps(t *testing.T) {
+	m := New("0200")
+	m.Set(2, "4111111111111111")
+	m.Set(3, "000000")
+	m.Set(70, "301")
+	got, err := m.Bitmaps(DefaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint64{0xE000000000000000, 0x0400000000000000}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bitmaps = %016X, want %016X", got, want)
+	}
+	m.Set(1, "x")
+	if _, err := m.Bitmaps(DefaultSpec); err == nil {
+		t.Fatal("expected error for field 1")
+	}
+}
@@ -0,0 +1,264 @@
+// Package emv reads and writes the BER-TLV encoded EMV chip data carried in
+// DE55.
+package emv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Tag is a BER-TLV tag with its bytes in big-endian order, e.g. 0x9F26.
+type Tag uint32
+
+// Tags commonly exchanged in authorisations.
+const (
+	TagAID                 Tag = 0x4F
+	TagAppLabel            Tag = 0x50
+	TagTrack2Equivalent    Tag = 0x57
+	TagPAN                 Tag = 0x5A
+	TagCardholderName      Tag = 0x5F20
+	TagAppExpiry           Tag = 0x5F24
+	TagTxnCurrency         Tag = 0x5F2A
+	TagPANSeq              Tag = 0x5F34
+	TagAIP                 Tag = 0x82
+	TagDFName              Tag = 0x84
+	TagAuthResponseCode    Tag = 0x8A
+	TagIssuerAuthData      Tag = 0x91
+	TagTVR                 Tag = 0x95
+	TagTxnDate             Tag = 0x9A
+	TagTSI                 Tag = 0x9B
+	TagTxnType             Tag = 0x9C
+	TagAmountAuthorised    Tag = 0x9F02
+	TagAmountOther         Tag = 0x9F03
+	TagAppVersion          Tag = 0x9F09
+	TagIssuerAppData       Tag = 0x9F10
+	TagTerminalCountry     Tag = 0x9F1A
+	TagIFDSerial           Tag = 0x9F1E
+	TagAppCryptogram       Tag = 0x9F26
+	TagCryptogramInfo      Tag = 0x9F27
+	TagTerminalCaps        Tag = 0x9F33
+	TagCVMResults          Tag = 0x9F34
+	TagTerminalType        Tag = 0x9F35
+	TagATC                 Tag = 0x9F36
+	TagUnpredictableNumber Tag = 0x9F37
+	TagTxnSeqCounter       Tag = 0x9F41
+	TagIssuerScript1       Tag = 0x71
+	TagIssuerScript2       Tag = 0x72
+)
+
+type tagInfo struct {
+	name      string
+	sensitive bool // cardholder data, masked in dumps
+}
+
+// dictionary names the tags above for dumps.
+var dictionary = map[Tag]tagInfo{
+	TagAID:                 {name: "AID"},
+	TagAppLabel:            {name: "AppLabel"},
+	TagTrack2Equivalent:    {name: "Track2Equivalent", sensitive: true},
+	TagPAN:                 {name: "PAN", sensitive: true},
+	TagCardholderName:      {name: "CardholderName", sensitive: true},
+	TagAppExpiry:           {name: "AppExpiry", sensitive: true},
+	TagTxnCurrency:         {name: "TxnCurrency"},
+	TagPANSeq:              {name: "PANSeq"},
+	TagAIP:                 {name: "AIP"},
+	TagDFName:              {name: "DFName"},
+	TagAuthResponseCode:    {name: "AuthResponseCode"},
+	TagIssuerAuthData:      {name: "IssuerAuthData"},
+	TagTVR:                 {name: "TVR"},
+	TagTxnDate:             {name: "TxnDate"},
+	TagTSI:                 {name: "TSI"},
+	TagTxnType:             {name: "TxnType"},
+	TagAmountAuthorised:    {name: "AmountAuthorised"},
+	TagAmountOther:         {name: "AmountOther"},
+	TagAppVersion:          {name: "AppVersion"},
+	TagIssuerAppData:       {name: "IssuerAppData"},
+	TagTerminalCountry:     {name: "TerminalCountry"},
+	TagIFDSerial:           {name: "IFDSerial"},
+	TagAppCryptogram:       {name: "AppCryptogram"},
+	TagCryptogramInfo:      {name: "CryptogramInfo"},
+	TagTerminalCaps:        {name: "TerminalCaps"},
+	TagCVMResults:          {name: "CVMResults"},
+	TagTerminalType:        {name: "TerminalType"},
+	TagATC:                 {name: "ATC"},
+	TagUnpredictableNumber: {name: "UnpredictableNumber"},
+	TagTxnSeqCounter:       {name: "TxnSeqCounter"},
+	TagIssuerScript1:       {name: "IssuerScript1"},
+	TagIssuerScript2:       {name: "IssuerScript2"},
+}
+
+// ParseTag parses a hex tag such as "9F26". The bytes must form exactly
+// one well-formed BER tag.
+func ParseTag(s string) (Tag, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s)%2 != 0 {
+		return 0, fmt.Errorf("invalid tag %q", s)
+	}
+	if t := Tag(v); t.Valid() && len(s) == 2*len(t.bytes()) {
+		return t, nil
+	}
+	return 0, fmt.Errorf("malformed BER tag %q", s)
+}
+
+// Valid reports whether t is a well-formed BER tag that Decode can read
+// back: a first byte other than 00, and subsequent bytes exactly when its
+// five low bits are all set, each but the last with bit 8 set.
+func (t Tag) Valid() bool {
+	b := t.bytes()
+	if b[0] == 0x00 {
+		return false
+	}
+	off := 0
+	got, err := readTag(b, &off)
+	return err == nil && got == t && off == len(b)
+}
+
+func (t Tag) String() string { return fmt.Sprintf("%X", t.bytes()) }
+
+// Name returns the dictionary name of t, or "" for unknown tags.
+func (t Tag) Name() string { return dictionary[t].name }
+
+// Sensitive reports whether t carries cardholder data.
+func (t Tag) Sensitive() bool { return dictionary[t].sensitive }
+
+// Constructed reports whether the value of t is itself BER-TLV encoded.
+func (t Tag) Constructed() bool { return t.bytes()[0]&0x20 != 0 }
+
+func (t Tag) bytes() []byte {
+	var b []byte
+	for v := uint32(t); ; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+		if v <= 0xFF {
+			return b
+		}
+	}
+}
+
+// TLV is one decoded data object.
+type TLV struct {
+	Tag   Tag
+	Value []byte
+}
+
+// Decode splits b into its top-level data objects in wire order. Values of
+// constructed tags are returned undecoded; pass them to Decode again to
+// read their contents. Zero padding between objects is skipped.
+func Decode(b []byte) ([]TLV, error) {
+	var out []TLV
+	for off := 0; off < len(b); {
+		if b[off] == 0x00 {
+			off++
+			continue
+		}
+		tag, err := readTag(b, &off)
+		if err != nil {
+			return nil, err
+		}
+		n, err := readLen(b, &off)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", tag, err)
+		}
+		if off+n > len(b) {
+			return nil, fmt.Errorf("tag %s: value truncated", tag)
+		}
+		out = append(out, TLV{Tag: tag, Value: b[off : off+n : off+n]})
+		off += n
+	}
+	return out, nil
+}
+
+// DecodeMap decodes b into a tag map. A repeated tag keeps its last value.
+func DecodeMap(b []byte) (map[Tag][]byte, error) {
+	list, err := Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[Tag][]byte, len(list))
+	for _, o := range list {
+		out[o.Tag] = o.Value
+	}
+	return out, nil
+}
+
+// Encode builds BER-TLV data from tags in canonical order, sorted by the
+// encoded tag bytes.
+func Encode(tags map[Tag][]byte) []byte {
+	keys := make([]Tag, 0, len(tags))
+	for t := range tags {
+		keys = append(keys, t)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i].bytes(), keys[j].bytes()) < 0 })
+	var buf bytes.Buffer
+	for _, t := range keys {
+		v := tags[t]
+		buf.Write(t.bytes())
+		writeLen(&buf, len(v))
+		buf.Write(v)
+	}
+	return buf.Bytes()
+}
+
+// readTag reads a tag of one or more bytes: a first byte with all five low
+// bits set is followed by bytes up to the first one with bit 8 clear.
+func readTag(b []byte, off *int) (Tag, error) {
+	t := Tag(b[*off])
+	more := b[*off]&0x1F == 0x1F
+	*off++
+	for n := 1; more; n++ {
+		if *off >= len(b) {
+			return 0, errors.New("tag truncated")
+		}
+		if n == 4 {
+			return 0, fmt.Errorf("tag %X... longer than 4 bytes", uint32(t))
+		}
+		if n == 1 && b[*off]&0x7F == 0 {
+			return 0, fmt.Errorf("tag %X%02X: first subsequent byte has no number bits", uint32(t), b[*off])
+		}
+		more = b[*off]&0x80 != 0
+		t = t<<8 | Tag(b[*off])
+		*off++
+	}
+	return t, nil
+}
+
+// readLen reads a short (one byte below 0x80) or long form length (0x81 to
+// 0x83 followed by that many length bytes).
+func readLen(b []byte, off *int) (int, error) {
+	if *off >= len(b) {
+		return 0, errors.New("length missing")
+	}
+	first := b[*off]
+	*off++
+	if first < 0x80 {
+		return int(first), nil
+	}
+	k := int(first & 0x7F)
+	if k == 0 || k > 3 {
+		return 0, fmt.Errorf("unsupported length form %02X", first)
+	}
+	if *off+k > len(b) {
+		return 0, errors.New("length truncated")
+	}
+	n := 0
+	for _, x := range b[*off : *off+k] {
+		n = n<<8 | int(x)
+	}
+	*off += k
+	return n, nil
+}
+
+func writeLen(buf *bytes.Buffer, n int) {
+	switch {
+	case n < 0x80:
+		buf.WriteByte(byte(n))
+	case n <= 0xFF:
+		buf.Write([]byte{0x81, byte(n)})
+	case n <= 0xFFFF:
+		buf.Write([]byte{0x82, byte(n >> 8), byte(n)})
+	default:
+		buf.Write([]byte{0x83, byte(n >> 16), byte(n >> 8), byte(n)})
+	}
+}
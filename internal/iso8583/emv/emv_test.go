@@ -0,0 +1,113 @@
+package emv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	b := unhex(t, "9F2608112233445566778800009F270180950500000080009A032610165F2A020840")
+	got, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TLV{
+		{TagAppCryptogram, unhex(t, "1122334455667788")},
+		{TagCryptogramInfo, unhex(t, "80")},
+		{TagTVR, unhex(t, "0000008000")},
+		{TagTxnDate, unhex(t, "261016")},
+		{TagTxnCurrency, unhex(t, "0840")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Decode = %X, want %X", got, want)
+	}
+}
+
+func TestEncodeCanonicalOrder(t *testing.T) {
+	tags := map[Tag][]byte{
+		TagAppCryptogram:  unhex(t, "1122334455667788"),
+		TagCryptogramInfo: {0x80},
+		TagTVR:            make([]byte, 5),
+		TagTxnDate:        unhex(t, "261016"),
+		TagTxnCurrency:    unhex(t, "0840"),
+	}
+	got := Encode(tags)
+	want := unhex(t, "5F2A020840950500000000009A032610169F260811223344556677889F270180")
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Encode = %X, want %X", got, want)
+	}
+	back, err := DecodeMap(got)
+	if err != nil || !reflect.DeepEqual(back, tags) {
+		t.Fatalf("DecodeMap = %X, %v", back, err)
+	}
+}
+
+func TestLongLengthsAndTags(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 255, 256, 70000} {
+		tags := map[Tag][]byte{0xDF8101: bytes.Repeat([]byte{0xAB}, n)}
+		back, err := DecodeMap(Encode(tags))
+		if err != nil || !reflect.DeepEqual(back, tags) {
+			t.Fatalf("len %d: round trip failed: %v", n, err)
+		}
+	}
+	if got := Tag(0xDF8101).String(); got != "DF8101" {
+		t.Fatalf("String = %s", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for name, in := range map[string]string{
+		"tag truncated":    "9F",
+		"length missing":   "9F26",
+		"value truncated":  "9F260811",
+		"length truncated": "9F2682",
+		"indefinite":       "9F2680",
+		"tag too long":     "DF8181818101",
+		"empty tag number": "9F800101",
+	} {
+		if _, err := Decode(unhex(t, in)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	if tag, err := ParseTag("9f26"); err != nil || tag != TagAppCryptogram || tag.Name() != "AppCryptogram" {
+		t.Fatalf("ParseTag = %v, %v", tag, err)
+	}
+	if tag, err := ParseTag("DF8101"); err != nil || tag != 0xDF8101 {
+		t.Fatalf("ParseTag(DF8101) = %v, %v", tag, err)
+	}
+	for _, s := range []string{
+		"", "9F2", "XYZ",
+		"00",       // padding, not a tag
+		"9F",       // subsequent byte missing
+		"DF81",     // last subsequent byte has bit 8 set
+		"9F80",     // first subsequent byte with no number bits
+		"5A01",     // single-byte tag followed by extra bytes
+		"9F2601",   // extra byte after a complete tag
+		"0057",     // leading zero byte
+		"DF818181", // four bytes still continuing
+	} {
+		if _, err := ParseTag(s); err == nil {
+			t.Errorf("ParseTag(%q): expected error", s)
+		}
+	}
+	if !TagPAN.Sensitive() || TagAppCryptogram.Sensitive() {
+		t.Fatal("sensitivity")
+	}
+	if !TagIssuerScript1.Constructed() || TagTVR.Constructed() {
+		t.Fatal("constructed")
+	}
+}
@@ -0,0 +1,56 @@
+package iso8583
+
+import (
+	"fmt"
+
+	"go-payment-gateway/internal/iso8583/emv"
+)
+
+// fieldICC is DE55, the EMV chip data. Its value holds the raw BER-TLV
+// bytes.
+const fieldICC = 55
+
+// EMV decodes the tags carried in DE55. A message without DE55 returns an
+// empty map.
+func (m *Message) EMV() (map[emv.Tag][]byte, error) {
+	v, ok := m.Get(fieldICC)
+	if !ok {
+		return map[emv.Tag][]byte{}, nil
+	}
+	tags, err := emv.DecodeMap([]byte(v))
+	if err != nil {
+		return nil, fmt.Errorf("DE%d: %w", fieldICC, err)
+	}
+	return tags, nil
+}
+
+// SetEMV replaces DE55 with tags encoded in canonical order, or removes it
+// when tags is empty.
+func (m *Message) SetEMV(tags map[emv.Tag][]byte) {
+	if len(tags) == 0 {
+		delete(m.Fields, fieldICC)
+		return
+	}
+	m.Set(fieldICC, string(emv.Encode(tags)))
+}
+
+// EMVTag returns the value of one DE55 tag.
+func (m *Message) EMVTag(t emv.Tag) ([]byte, bool, error) {
+	tags, err := m.EMV()
+	if err != nil {
+		return nil, false, err
+	}
+	v, ok := tags[t]
+	return v, ok, nil
+}
+
+// SetEMVTag sets one DE55 tag, keeping the others, and re-encodes DE55.
+func (m *Message) SetEMVTag(t emv.Tag, v []byte) error {
+	tags, err := m.EMV()
+	if err != nil {
+		return err
+	}
+	tags[t] = v
+	m.SetEMV(tags)
+	return nil
+}
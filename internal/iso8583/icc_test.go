@@ -0,0 +1,46 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+
+	"go-payment-gateway/internal/iso8583/emv"
+)
+
+func TestEMVAccessors(t *testing.T) {
+	m := New("0100")
+	if tags, err := m.EMV(); err != nil || len(tags) != 0 {
+		t.Fatalf("EMV on empty message = %v, %v", tags, err)
+	}
+	if err := m.SetEMVTag(emv.TagAppCryptogram, []byte{1, 2, 3, 4, 5, 6, 7, 8}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetEMVTag(emv.TagTxnCurrency, []byte{0x08, 0x40}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := m.Pack(DefaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unpack(DefaultSpec, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok, err := got.EMVTag(emv.TagTxnCurrency)
+	if err != nil || !ok || !bytes.Equal(v, []byte{0x08, 0x40}) {
+		t.Fatalf("EMVTag = %X, %v, %v", v, ok, err)
+	}
+	if de55, _ := got.Get(55); de55[0] != 0x5F {
+		t.Fatalf("DE55 not in canonical order: %X", de55)
+	}
+
+	m.Set(55, "\x9F\x26\x08\x01")
+	if _, _, err := m.EMVTag(emv.TagAppCryptogram); err == nil {
+		t.Fatal("expected error for truncated DE55")
+	}
+	m.SetEMV(nil)
+	if _, ok := m.Get(55); ok {
+		t.Fatal("SetEMV(nil) kept DE55")
+	}
+}
@@ -2,7 +2,6 @@ package iso8583
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
@@ -10,12 +9,14 @@ import (
 )
 
 // Message represents a minimal ISO8583 message used here.
-// MTI: 4 ASCII bytes
-// Bitmap: 8 bytes primary (and optional secondary)
-// Field encoding is defined by the CommonSpec table.
+// MTI: 4 characters
+// Bitmap: primary, optional secondary and (if the spec allows) tertiary
+// Field encoding is defined by the Spec passed to Pack and Unpack.
 type Message struct {
 	MTI    string
 	Fields map[int]string // field number -> ASCII string
+
+	spec *Spec // spec the message was unpacked with, see Spec
 }
 
 // New creates an empty ISO8583 message with given MTI.
@@ -23,6 +24,18 @@ func New(mti string) *Message {
 	return &Message{MTI: mti, Fields: make(map[int]string)}
 }
 
+// Spec returns the spec the message was unpacked with or given by SetSpec,
+// or DefaultSpec. Redacted and the sub-field accessors use it.
+func (m *Message) Spec() *Spec {
+	if m.spec == nil {
+		return DefaultSpec
+	}
+	return m.spec
+}
+
+// SetSpec sets the spec returned by Spec. It does not affect Pack.
+func (m *Message) SetSpec(spec *Spec) { m.spec = spec }
+
 // Set sets a field value as ASCII string.
 func (m *Message) Set(field int, value string) { m.Fields[field] = value }
 
@@ -31,210 +44,213 @@ func (m *Message) Get(field int) (string, bool) { v, ok := m.Fields[field]; retu
 
 // packLLVAR writes a value prefixed with a 2-digit ASCII length.
 func packLLVAR(buf *bytes.Buffer, v string) error {
-	if len(v) > 99 {
-		return fmt.Errorf("value too long for LLVAR: %d", len(v))
-	}
-	buf.WriteString(fmt.Sprintf("%02d", len(v)))
-	buf.WriteString(v)
-	return nil
+	return packVar(buf, asciiLL, v, 0, CharsetASCII, CharsetASCII)
 }
 
 // packLLLVAR writes a value prefixed with a 3-digit ASCII length.
 func packLLLVAR(buf *bytes.Buffer, v string) error {
-	if len(v) > 999 {
-		return fmt.Errorf("value too long for LLLVAR: %d", len(v))
-	}
-	buf.WriteString(fmt.Sprintf("%03d", len(v)))
-	buf.WriteString(v)
-	return nil
+	return packVar(buf, asciiLLL, v, 0, CharsetASCII, CharsetASCII)
 }
 
 // unpackLLVAR reads a LLVAR value starting at *off in b.
 // It returns the string and advances *off.
 func unpackLLVAR(b []byte, off *int) (string, error) {
-	if *off+2 > len(b) {
-		return "", errors.New("truncated LLVAR length")
-	}
-	l, err := strconv.Atoi(string(b[*off : *off+2]))
-	if err != nil {
-		return "", fmt.Errorf("invalid LLVAR length: %w", err)
-	}
-	*off += 2
-	if *off+l > len(b) {
-		return "", errors.New("truncated LLVAR value")
-	}
-	v := string(b[*off : *off+l])
-	*off += l
-	return v, nil
+	return unpackVar(b, off, asciiLL, 0, CharsetASCII, CharsetASCII)
 }
 
 // unpackLLLVAR reads a LLLVAR value starting at *off in b and advances *off.
 func unpackLLLVAR(b []byte, off *int) (string, error) {
-	if *off+3 > len(b) {
-		return "", errors.New("truncated LLLVAR length")
-	}
-	l, err := strconv.Atoi(string(b[*off : *off+3]))
-	if err != nil {
-		return "", fmt.Errorf("invalid LLLVAR length: %w", err)
-	}
-	*off += 3
-	if *off+l > len(b) {
-		return "", errors.New("truncated LLLVAR value")
-	}
-	v := string(b[*off : *off+l])
-	*off += l
-	return v, nil
+	return unpackVar(b, off, asciiLLL, 0, CharsetASCII, CharsetASCII)
 }
 
-// Pack builds a wire message: [2B MLI][4B MTI ASCII][8B bitmap][fields...]
-// Numeric fields are encoded as ASCII. Variable-length fields use ASCII length
-// headers (LLVAR/LLLVAR) where appropriate.
-func (m *Message) Pack() ([]byte, error) {
-	if len(m.MTI) != 4 {
-		return nil, fmt.Errorf("invalid MTI: %q", m.MTI)
+// Pack builds a message body: [4B MTI][bitmaps][fields...] using spec, or
+// DefaultSpec if spec is nil. Framing such as the MLI is added by the
+// transport. The MTI must pass ValidateMTI and each field its content
+// class; field errors are *FieldError. The MTI and character data are
+// encoded in the spec's Charset, bitmaps in its Bitmap encoding. Each
+// field is encoded with the codec from its FieldSpec: ASCII, packed BCD or
+// binary, with ASCII, BCD or binary length headers for variable fields.
+// If the spec has a MAC key, Pack fills DE64, or DE128 when the secondary
+// bitmap is used, with the MAC; m itself is left unchanged.
+func (m *Message) Pack(spec *Spec) ([]byte, error) {
+	if spec == nil {
+		spec = DefaultSpec
 	}
-
-	// Build bitmaps
-	var primary, secondary uint64
-	set := func(bit int) {
-		if bit <= 64 {
-			primary |= (1 << (64 - bit))
-		} else {
-			secondary |= (1 << (128 - bit))
-		}
+	if err := ValidateMTI(m.MTI); err != nil {
+		return nil, err
 	}
-	for f := range m.Fields {
-		if f < 1 || f > 128 || f == 1 {
-			return nil, fmt.Errorf("unsupported field %d", f)
-		}
-		set(f)
+
+	fields, macField := m.Fields, 0
+	if spec.MAC != nil && spec.MAC.Key != nil {
+		fields, macField = withMACField(m.Fields)
 	}
-	if secondary != 0 {
-		primary |= (1 << 63) // bit 1 indicates secondary bitmap
+	bms, err := bitmapsOf(spec, fields)
+	if err != nil {
+		return nil, err
 	}
-
-	body := bytes.NewBuffer(nil)
-	body.WriteString(m.MTI)
-	var bm [8]byte
-	binary.BigEndian.PutUint64(bm[:], primary)
-	body.Write(bm[:])
-	if secondary != 0 {
-		binary.BigEndian.PutUint64(bm[:], secondary)
-		body.Write(bm[:])
+	hdr := spec.Charset.Encode(m.MTI)
+	offs := map[int][2]int{0: {0, len(hdr)}}
+	for _, v := range bms {
+		hdr = spec.Bitmap.write(hdr, v)
 	}
+	body := bytes.NewBuffer(hdr)
 
 	// Encode fields in numeric order
-	for f := 2; f <= 128; f++ {
-		v, ok := m.Fields[f]
+	for f := 2; f <= spec.maxField(); f++ {
+		v, ok := fields[f]
 		if !ok {
 			continue
 		}
-		spec, ok := CommonSpec[f]
+		fs, ok := spec.Fields[f]
 		if !ok {
 			return nil, fmt.Errorf("field %d not implemented in spec", f)
 		}
-		switch spec.Codec {
-		case FmtFixedNum, FmtFixedAns:
-			if len(v) != spec.Len {
-				return nil, fmt.Errorf("DE%d must be %d characters, got %d", f, spec.Len, len(v))
-			}
-			body.WriteString(v)
-		case FmtLLVAR:
-			if err := packLLVAR(body, v); err != nil {
-				return nil, fmt.Errorf("DE%d: %w", f, err)
-			}
-		case FmtLLLVAR:
-			if err := packLLLVAR(body, v); err != nil {
-				return nil, fmt.Errorf("DE%d: %w", f, err)
-			}
-		default:
-			return nil, fmt.Errorf("field %d has unknown codec", f)
+		if f == macField {
+			v, err = spec.macValue(f, body.Bytes(), offs)
+		} else {
+			err = validateField(fs, v)
+		}
+		if err != nil {
+			return nil, &FieldError{Field: f, Err: err}
 		}
+		start := body.Len()
+		if err := packField(body, fs, v, spec.charsetFor(fs)); err != nil {
+			return nil, &FieldError{Field: f, Err: err}
+		}
+		offs[f] = [2]int{start, body.Len()}
 	}
 
-	// Prepend MLI
-	msg := body.Bytes()
-	mli := make([]byte, 2)
-	binary.BigEndian.PutUint16(mli, uint16(len(msg)))
-	return append(mli, msg...), nil
+	return body.Bytes(), nil
 }
 
-// Unpack parses the minimal wire format from Pack().
-func Unpack(b []byte) (*Message, error) {
-	if len(b) < 2 {
-		return nil, errors.New("buffer too short for MLI")
+// Bitmaps returns the bitmaps Pack writes for m with spec, or DefaultSpec
+// if spec is nil: the primary, then the secondary and tertiary if needed.
+func (m *Message) Bitmaps(spec *Spec) ([]uint64, error) {
+	if spec == nil {
+		spec = DefaultSpec
 	}
-	mli := int(binary.BigEndian.Uint16(b[:2]))
-	if len(b)-2 < mli {
-		return nil, fmt.Errorf("incomplete message: need %d, have %d", mli, len(b)-2)
+	return bitmapsOf(spec, m.Fields)
+}
+
+func bitmapsOf(spec *Spec, fields map[int]string) ([]uint64, error) {
+	var bm bitmap
+	for f := range fields {
+		if f < 2 || f > spec.maxField() || (f == 65 && spec.TertiaryBitmap) {
+			return nil, fmt.Errorf("unsupported field %d", f)
+		}
+		bm.set(f)
 	}
-	p := b[2 : 2+mli]
-	if len(p) < 12 {
-		return nil, errors.New("too short for MTI+bitmap")
+	if bm[2] != 0 {
+		bm.set(65) // bit 65 indicates tertiary bitmap
 	}
-	mti := string(p[:4])
-	primary := binary.BigEndian.Uint64(p[4:12])
-	off := 12
-	var secondary uint64
-	if primary&(1<<63) != 0 {
-		if len(p) < off+8 {
-			return nil, errors.New("too short for secondary bitmap")
-		}
-		secondary = binary.BigEndian.Uint64(p[off : off+8])
-		off += 8
+	if bm[1] != 0 {
+		bm.set(1) // bit 1 indicates secondary bitmap
+	}
+	n := 1
+	for n < len(bm) && bm[n] != 0 {
+		n++
 	}
+	return bm[:n], nil
+}
 
-	m := New(mti)
-	present := func(bit int) bool {
-		if bit <= 64 {
-			return (primary & (1 << (64 - bit))) != 0
+// Unpack parses a message body produced by Pack() using spec, or
+// DefaultSpec if spec is nil. p must hold exactly one message. The MTI and
+// field contents are validated as in Pack.
+func Unpack(spec *Spec, p []byte) (*Message, error) {
+	if spec == nil {
+		spec = DefaultSpec
+	}
+	m, _, err := unpack(spec, p, nil)
+	return m, err
+}
+
+// UnpackLenient is Unpack without the content class checks, for looking
+// at malformed messages: fields that fail their class are kept as decoded
+// and reported, in field order, instead of failing the unpack. Framing
+// errors such as a bad length or trailing bytes still fail.
+func UnpackLenient(spec *Spec, p []byte) (*Message, []*FieldError, error) {
+	if spec == nil {
+		spec = DefaultSpec
+	}
+	var invalid []*FieldError
+	m, _, err := unpack(spec, p, &invalid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, invalid, nil
+}
+
+// unpack also returns where each field's wire form starts and ends in p,
+// with the MTI under field 0. If invalid is not nil, class errors are
+// appended to it rather than returned.
+func unpack(spec *Spec, p []byte, invalid *[]*FieldError) (*Message, map[int][2]int, error) {
+	if len(p) < 4 {
+		return nil, nil, errors.New("too short for MTI")
+	}
+	mti := spec.Charset.Decode(p[:4])
+	if err := ValidateMTI(mti); err != nil {
+		return nil, nil, err
+	}
+	off := 4
+	offs := map[int][2]int{0: {0, 4}}
+	var bm bitmap
+	var err error
+	if bm[0], err = spec.Bitmap.read(p, &off); err != nil {
+		return nil, nil, fmt.Errorf("primary bitmap: %w", err)
+	}
+	if bm.has(1) {
+		if bm[1], err = spec.Bitmap.read(p, &off); err != nil {
+			return nil, nil, fmt.Errorf("secondary bitmap: %w", err)
+		}
+	}
+	if spec.TertiaryBitmap && bm.has(65) {
+		if bm[2], err = spec.Bitmap.read(p, &off); err != nil {
+			return nil, nil, fmt.Errorf("tertiary bitmap: %w", err)
 		}
-		return (secondary & (1 << (128 - bit))) != 0
 	}
 
-	for f := 2; f <= 128; f++ {
-		if !present(f) {
+	m := New(mti)
+	m.spec = spec
+	for f := 2; f <= spec.maxField(); f++ {
+		if !bm.has(f) || (f == 65 && spec.TertiaryBitmap) {
 			continue
 		}
-		spec, ok := CommonSpec[f]
+		fs, ok := spec.Fields[f]
 		if !ok {
-			return nil, fmt.Errorf("field %d not implemented in spec", f)
+			return nil, nil, fmt.Errorf("field %d not implemented in spec", f)
 		}
-		switch spec.Codec {
-		case FmtFixedNum, FmtFixedAns:
-			if off+spec.Len > len(p) {
-				return nil, fmt.Errorf("truncated DE%d", f)
-			}
-			m.Fields[f] = string(p[off : off+spec.Len])
-			off += spec.Len
-		case FmtLLVAR:
-			v, err := unpackLLVAR(p, &off)
-			if err != nil {
-				return nil, fmt.Errorf("DE%d: %w", f, err)
-			}
-			m.Fields[f] = v
-		case FmtLLLVAR:
-			v, err := unpackLLLVAR(p, &off)
-			if err != nil {
-				return nil, fmt.Errorf("DE%d: %w", f, err)
+		start := off
+		v, err := unpackField(p, &off, fs, spec.charsetFor(fs))
+		if err != nil {
+			return nil, nil, &FieldError{Field: f, Err: err}
+		}
+		if err := validateField(fs, v); err != nil {
+			if invalid == nil {
+				return nil, nil, &FieldError{Field: f, Err: err}
 			}
-			m.Fields[f] = v
-		default:
-			return nil, fmt.Errorf("field %d has unknown codec", f)
+			*invalid = append(*invalid, &FieldError{Field: f, Err: err})
 		}
+		m.Fields[f] = v
+		offs[f] = [2]int{start, off}
 	}
 	if off != len(p) {
-		return nil, fmt.Errorf("extra bytes at end: %d", len(p)-off)
+		return nil, nil, fmt.Errorf("extra bytes at end: %d", len(p)-off)
 	}
-	return m, nil
+	return m, offs, nil
 }
 
 // Helpers for Echo Test messages
 func NewEchoRequest(stan int) *Message {
+	return NewNetworkRequest("301", stan) // 301 = Echo Test
+}
+
+// NewNetworkRequest builds an 0800 with the given DE70 network management
+// code, e.g. "001" sign-on or "161" new key request.
+func NewNetworkRequest(code string, stan int) *Message {
 	m := New("0800")
-	m.Set(7, time.Now().UTC().Format("0102150405")) // MMDDhhmmss
-	m.Set(11, fmt.Sprintf("%06d", stan%1000000))
-	m.Set(70, "301") // 301 = Echo Test
+	m.SetTransmissionTime(time.Now())
+	m.SetSTAN(stan)
+	m.Set(70, code)
 	return m
 }
 
@@ -249,6 +265,21 @@ func IsEchoResponse(m *Message) bool {
 	return ok
 }
 
+// ResponseMTI returns the response MTI for a request, e.g. 0800 -> 0810 or
+// 0420 -> 0430. A repeat is answered like the original, so 0401 -> 0410
+// and 0421 -> 0430.
+func ResponseMTI(mti string) string {
+	if len(mti) != 4 || mti[2] < '0' || mti[2] > '8' {
+		return mti
+	}
+	origin := mti[3]
+	switch origin {
+	case '1', '3', '5': // repeats
+		origin--
+	}
+	return mti[:2] + string(mti[2]+1) + string(origin)
+}
+
 // MustParseSTAN parses DE11 to int (for logging/correlation).
 func MustParseSTAN(m *Message) int {
 	v, _ := m.Get(11)
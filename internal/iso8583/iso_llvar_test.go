@@ -48,7 +48,7 @@ func TestMessageWithVariableFields(t *testing.T) {
 	m.Set(48, "HELLO WORLD")
 	m.Set(102, "ACC1234567")
 
-	packed, err := m.Pack()
+	packed, err := m.Pack(DefaultSpec)
 	if err != nil {
 		t.Fatalf("Pack: %v", err)
 	}
@@ -60,7 +60,7 @@ func TestMessageWithVariableFields(t *testing.T) {
 		t.Fatalf("packed message missing DE102")
 	}
 
-	m2, err := Unpack(packed)
+	m2, err := Unpack(DefaultSpec, packed)
 	if err != nil {
 		t.Fatalf("Unpack: %v", err)
 	}
@@ -17,7 +17,7 @@ func TestSetGet(t *testing.T) {
 func TestPackInvalidLength(t *testing.T) {
 	m := New("0200")
 	m.Set(11, "12345") // should be 6
-	if _, err := m.Pack(); err == nil {
+	if _, err := m.Pack(DefaultSpec); err == nil {
 		t.Fatalf("expected error for invalid length")
 	}
 }
@@ -25,7 +25,7 @@ func TestPackInvalidLength(t *testing.T) {
 func TestPackInvalidMTI(t *testing.T) {
 	m := New("123")
 	m.Set(11, "123456")
-	if _, err := m.Pack(); err == nil {
+	if _, err := m.Pack(DefaultSpec); err == nil {
 		t.Fatalf("expected MTI length error")
 	}
 }
@@ -33,7 +33,7 @@ func TestPackInvalidMTI(t *testing.T) {
 func TestPackUnknownField(t *testing.T) {
 	m := New("0200")
 	m.Set(100, "abc")
-	if _, err := m.Pack(); err == nil || !strings.Contains(err.Error(), "not implemented") {
+	if _, err := m.Pack(DefaultSpec); err == nil || !strings.Contains(err.Error(), "not implemented") {
 		t.Fatalf("expected spec error, got %v", err)
 	}
 }
@@ -41,7 +41,7 @@ func TestPackUnknownField(t *testing.T) {
 func TestPackLLVARTooLong(t *testing.T) {
 	m := New("0200")
 	m.Set(2, strings.Repeat("1", 100))
-	if _, err := m.Pack(); err == nil {
+	if _, err := m.Pack(DefaultSpec); err == nil {
 		t.Fatalf("expected LLVAR length error")
 	}
 }
@@ -49,7 +49,7 @@ func TestPackLLVARTooLong(t *testing.T) {
 func TestPackLLLVARTooLong(t *testing.T) {
 	m := New("0200")
 	m.Set(55, strings.Repeat("A", 1000))
-	if _, err := m.Pack(); err == nil {
+	if _, err := m.Pack(DefaultSpec); err == nil {
 		t.Fatalf("expected LLLVAR length error")
 	}
 }
@@ -58,12 +58,12 @@ func TestUnpackTruncated(t *testing.T) {
 	m := New("0200")
 	m.Set(7, "0102030405")
 	m.Set(11, "123456")
-	p, err := m.Pack()
+	p, err := m.Pack(DefaultSpec)
 	if err != nil {
 		t.Fatalf("Pack: %v", err)
 	}
 	p = p[:len(p)-1]
-	if _, err := Unpack(p); err == nil {
+	if _, err := Unpack(DefaultSpec, p); err == nil {
 		t.Fatalf("expected error for truncated message")
 	}
 }
@@ -71,18 +71,18 @@ func TestUnpackTruncated(t *testing.T) {
 func TestUnpackUnknownField(t *testing.T) {
 	m := New("0200")
 	m.Set(70, "301") // ensures secondary bitmap
-	p, err := m.Pack()
+	p, err := m.Pack(DefaultSpec)
 	if err != nil {
 		t.Fatalf("Pack: %v", err)
 	}
 	// Set bit 100 in secondary bitmap
-	primaryOffset := 2 + 4
+	primaryOffset := 4
 	secondaryOffset := primaryOffset + 8
 	sec := binary.BigEndian.Uint64(p[secondaryOffset : secondaryOffset+8])
 	sec |= 1 << 28 // bit 100
 	binary.BigEndian.PutUint64(p[secondaryOffset:secondaryOffset+8], sec)
 
-	if _, err := Unpack(p); err == nil || !strings.Contains(err.Error(), "field 100 not implemented") {
+	if _, err := Unpack(DefaultSpec, p); err == nil || !strings.Contains(err.Error(), "field 100 not implemented") {
 		t.Fatalf("expected unknown field error, got %v", err)
 	}
 }
@@ -90,13 +90,12 @@ func TestUnpackUnknownField(t *testing.T) {
 func TestUnpackExtraBytes(t *testing.T) {
 	m := New("0200")
 	m.Set(11, "123456")
-	p, err := m.Pack()
+	p, err := m.Pack(DefaultSpec)
 	if err != nil {
 		t.Fatalf("Pack: %v", err)
 	}
 	p = append(p, 'X')
-	binary.BigEndian.PutUint16(p[:2], uint16(len(p)-2))
-	if _, err := Unpack(p); err == nil || !strings.Contains(err.Error(), "extra bytes") {
+	if _, err := Unpack(DefaultSpec, p); err == nil || !strings.Contains(err.Error(), "extra bytes") {
 		t.Fatalf("expected extra bytes error, got %v", err)
 	}
 }
@@ -105,11 +104,11 @@ func TestBadDataResponse(t *testing.T) {
 	// Simulate acquirer responding with format error (39=30)
 	m := New("0210")
 	m.Set(39, "30")
-	p, err := m.Pack()
+	p, err := m.Pack(DefaultSpec)
 	if err != nil {
 		t.Fatalf("Pack: %v", err)
 	}
-	m2, err := Unpack(p)
+	m2, err := Unpack(DefaultSpec, p)
 	if err != nil {
 		t.Fatalf("Unpack: %v", err)
 	}
@@ -140,4 +139,14 @@ func TestEchoHelpers(t *testing.T) {
 	if IsEchoResponse(resp) {
 		t.Fatalf("IsEchoResponse true for invalid response")
 	}
+
+	for req, want := range map[string]string{
+		"0100": "0110", "0200": "0210", "0220": "0230", "0800": "0810",
+		"0400": "0410", "0401": "0410", "0420": "0430", "0421": "0430",
+		"0203": "0212",
+	} {
+		if got := ResponseMTI(req); got != want {
+			t.Errorf("ResponseMTI(%s) = %s, want %s", req, got, want)
+		}
+	}
 }
@@ -0,0 +1,157 @@
+package iso8583
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-payment-gateway/internal/mac"
+)
+
+// MAC errors, wrapped in a FieldError for the MAC field.
+var (
+	ErrMACMissing = errors.New("MAC missing")
+	ErrMAC        = errors.New("MAC verification failed")
+)
+
+// MACConfig selects how messages of a spec are authenticated. The MAC goes
+// in DE64, or in DE128 when the message uses the secondary bitmap.
+type MACConfig struct {
+	Algorithm mac.Algorithm `json:"algorithm"`
+	// Fields lists the fields the MAC block covers, in order, 0 being the
+	// MTI; each contributes its wire form. If empty, the MAC covers the
+	// whole message up to the MAC field.
+	Fields []int `json:"fields,omitempty"`
+	// Key is never read from spec files; see Spec.WithMACKey.
+	Key []byte `json:"-"`
+}
+
+// WithMACKey returns a copy of the spec that MACs with key.
+func (s *Spec) WithMACKey(key []byte) (*Spec, error) {
+	if s.MAC == nil {
+		return nil, fmt.Errorf("spec %q has no MAC algorithm", s.Name)
+	}
+	if n := s.MAC.Algorithm.KeyLen(); len(key) != n {
+		return nil, fmt.Errorf("%s needs a %d-byte key, got %d", s.MAC.Algorithm, n, len(key))
+	}
+	c := *s
+	cfg := *s.MAC
+	cfg.Key = append([]byte(nil), key...)
+	c.MAC = &cfg
+	return &c, nil
+}
+
+// macFieldOf returns the MAC field for a message with these fields: DE128
+// if any field above 64 is present, else DE64.
+func macFieldOf(fields map[int]string) int {
+	for f := range fields {
+		if f > 64 {
+			return 128
+		}
+	}
+	return 64
+}
+
+// withMACField returns a copy of fields with a placeholder in the MAC
+// field, dropping any MAC the caller set.
+func withMACField(fields map[int]string) (map[int]string, int) {
+	out := make(map[int]string, len(fields)+1)
+	for f, v := range fields {
+		if f != 64 && f != 128 {
+			out[f] = v
+		}
+	}
+	f := macFieldOf(out)
+	out[f] = ""
+	return out, f
+}
+
+// macBlock returns the data the MAC covers. p holds the packed message up
+// to at least end, the start of the MAC field; offs locates each field.
+func (c *MACConfig) macBlock(p []byte, end int, offs map[int][2]int) []byte {
+	if len(c.Fields) == 0 {
+		return p[:end]
+	}
+	var out []byte
+	for _, f := range c.Fields {
+		if o, ok := offs[f]; ok {
+			out = append(out, p[o[0]:o[1]]...)
+		}
+	}
+	return out
+}
+
+// macValue computes the MAC field value for a message packed up to p.
+func (s *Spec) macValue(f int, p []byte, offs map[int][2]int) (string, error) {
+	sum, err := mac.Compute(s.MAC.Algorithm, s.MAC.Key, s.MAC.macBlock(p, len(p), offs))
+	if err != nil {
+		return "", err
+	}
+	fs := s.Fields[f]
+	if rawData(fs.Codec) {
+		return string(sum[:fs.Len]), nil
+	}
+	return strings.ToUpper(hex.EncodeToString(sum))[:fs.Len], nil
+}
+
+// VerifyMAC checks the MAC of a packed message. It does nothing if the
+// spec has no MAC key. Failures are *FieldError wrapping ErrMAC or
+// ErrMACMissing.
+func (s *Spec) VerifyMAC(p []byte) error {
+	if s.MAC == nil || s.MAC.Key == nil {
+		return nil
+	}
+	m, offs, err := unpack(s, p, nil)
+	if err != nil {
+		return err
+	}
+	f := macFieldOf(m.Fields)
+	got, ok, err := m.GetBytes(s, f) // raw bytes or decoded hex digits
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &FieldError{Field: f, Err: ErrMACMissing}
+	}
+	ok, err = mac.Verify(s.MAC.Algorithm, s.MAC.Key, s.MAC.macBlock(p, offs[f][0], offs), got)
+	if err != nil {
+		return &FieldError{Field: f, Err: err}
+	}
+	if !ok {
+		return &FieldError{Field: f, Err: ErrMAC}
+	}
+	return nil
+}
+
+// validate checks the MAC settings against the spec's fields.
+func (c *MACConfig) validate(s *Spec) error {
+	if _, err := mac.ParseAlgorithm(c.Algorithm.String()); err != nil {
+		return err
+	}
+	if s.TertiaryBitmap {
+		return errors.New("MAC is not supported with a tertiary bitmap")
+	}
+	for _, f := range c.Fields {
+		if f < 0 || f > s.maxField() || f == 1 || f == 64 || f == 128 {
+			return fmt.Errorf("MAC cannot cover field %d", f)
+		}
+	}
+	fs, ok := s.Fields[64]
+	if !ok {
+		return errors.New("MAC needs DE64")
+	}
+	for _, f := range []int{64, 128} {
+		fs, ok = s.Fields[f]
+		if !ok {
+			continue
+		}
+		switch {
+		case fs.Codec == FmtBinary && fs.Len <= mac.Size:
+		case fs.Codec == FmtFixedAns && fs.Class == ClassH && fs.Len <= 2*mac.Size && fs.Len%2 == 0:
+		default:
+			return fmt.Errorf("DE%d must be binary of up to %d bytes or fixed-ans class h of up to %d hex digits", f, mac.Size, 2*mac.Size)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package iso8583
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"go-payment-gateway/internal/mac"
+)
+
+var testMACKey, _ = hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+
+func macSpec(t *testing.T, base *Spec, cfg MACConfig) *Spec {
+	t.Helper()
+	c := *base
+	c.MAC = &cfg
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.WithMACKey(testMACKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func macRequest() *Message {
+	m := New("0200")
+	m.Set(2, "4111111111111111")
+	m.Set(3, "000000")
+	m.Set(4, "000000001000")
+	m.Set(11, "000123")
+	m.Set(41, "TERM0001")
+	return m
+}
+
+func TestPackAddsMAC(t *testing.T) {
+	bcd, err := LoadSpec("../../specs/bcd-switch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, base := range []*Spec{DefaultSpec, bcd} {
+		for _, alg := range []mac.Algorithm{mac.X99, mac.X919, mac.ISO9797Alg3} {
+			c := *base
+			c.MAC = &MACConfig{Algorithm: alg}
+			spec, err := c.WithMACKey(testMACKey[:alg.KeyLen()])
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := macRequest()
+			p, err := m.Pack(spec)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", base.Name, alg, err)
+			}
+			if _, ok := m.Get(64); ok {
+				t.Fatal("Pack modified the message")
+			}
+			if err := spec.VerifyMAC(p); err != nil {
+				t.Fatalf("%s/%s: VerifyMAC: %v", base.Name, alg, err)
+			}
+			got, err := Unpack(spec, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _, _ := got.GetBytes(spec, 64)
+			want, _ := mac.Compute(alg, testMACKey[:alg.KeyLen()], p[:len(p)-spec.Fields[64].Len])
+			if !bytes.Equal(b, want) {
+				t.Fatalf("%s/%s: DE64 = %X, want MAC over the rest %X", base.Name, alg, b, want)
+			}
+		}
+	}
+}
+
+func TestVerifyMACRejectsTampering(t *testing.T) {
+	spec := macSpec(t, DefaultSpec, MACConfig{Algorithm: mac.X919})
+	p, err := macRequest().Pack(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(p, []byte("000000001000"), []byte("000000009000"), 1)
+	if err := spec.VerifyMAC(tampered); !errors.Is(err, ErrMAC) {
+		t.Fatalf("VerifyMAC(tampered) = %v, want ErrMAC", err)
+	}
+
+	plain, err := macRequest().Pack(DefaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fe *FieldError
+	if err := spec.VerifyMAC(plain); !errors.Is(err, ErrMACMissing) || !errors.As(err, &fe) || fe.Field != 64 {
+		t.Fatalf("VerifyMAC(no MAC) = %v, want ErrMACMissing on DE64", err)
+	}
+	if err := DefaultSpec.VerifyMAC(plain); err != nil {
+		t.Fatalf("VerifyMAC without key = %v", err)
+	}
+}
+
+func TestMACUsesDE128WithSecondaryBitmap(t *testing.T) {
+	spec := macSpec(t, DefaultSpec, MACConfig{Algorithm: mac.X919})
+	m := NewNetworkRequest("301", 7)
+	m.Set(64, "0000000000000000") // dropped: the MAC belongs in DE128
+	p, err := m.Pack(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unpack(spec, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Get(64); ok {
+		t.Fatal("DE64 present with secondary bitmap")
+	}
+	if _, ok := got.Get(128); !ok {
+		t.Fatal("DE128 missing")
+	}
+	if err := spec.VerifyMAC(p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMACBlockFields(t *testing.T) {
+	spec := macSpec(t, DefaultSpec, MACConfig{Algorithm: mac.X919, Fields: []int{0, 4, 11}})
+	p, err := macRequest().Pack(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.VerifyMAC(p); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := Unpack(spec, p)
+	b, _, _ := got.GetBytes(spec, 64)
+	want, _ := mac.Compute(mac.X919, testMACKey, []byte("0200000000001000000123"))
+	if !bytes.Equal(b, want) {
+		t.Fatalf("DE64 = %X, want %X", b, want)
+	}
+
+	// Fields outside the block may change without breaking the MAC.
+	changed := bytes.Replace(p, []byte("TERM0001"), []byte("TERM0002"), 1)
+	if err := spec.VerifyMAC(changed); err != nil {
+		t.Fatalf("VerifyMAC after changing an uncovered field: %v", err)
+	}
+}
+
+func TestMACSpecFile(t *testing.T) {
+	in := `{"name":"m","mac":{"algorithm":"x9.19","fields":[0,2,4]},"fields":[
+		{"num":2,"codec":"llvar","class":"n"},
+		{"num":4,"codec":"fixed-num","len":12,"class":"n"},
+		{"num":64,"codec":"binary","len":8,"class":"b"}]}`
+	s, err := ParseSpec(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.MAC == nil || s.MAC.Algorithm != mac.X919 || len(s.MAC.Fields) != 3 || s.MAC.Key != nil {
+		t.Fatalf("MAC = %+v", s.MAC)
+	}
+	if _, err := s.WithMACKey(testMACKey[:8]); err == nil {
+		t.Fatal("WithMACKey accepted a short key")
+	}
+	if _, err := DefaultSpec.WithMACKey(testMACKey); err == nil {
+		t.Fatal("WithMACKey accepted a spec without MAC")
+	}
+
+	for name, in := range map[string]string{
+		"algorithm": `{"mac":{"algorithm":"cmac"},"fields":[{"num":64,"codec":"binary","len":8}]}`,
+		"no DE64":   `{"mac":{"algorithm":"x9.9"},"fields":[]}`,
+		"DE64 type": `{"mac":{"algorithm":"x9.9"},"fields":[{"num":64,"codec":"llvar"}]}`,
+		"covers 64": `{"mac":{"algorithm":"x9.9","fields":[64]},"fields":[{"num":64,"codec":"binary","len":8}]}`,
+	} {
+		if _, err := ParseSpec(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestResolveMAC(t *testing.T) {
+	if s, err := ResolveMAC(DefaultSpec, "", ""); err != nil || s != DefaultSpec {
+		t.Fatalf("no flags: %v, %v", s, err)
+	}
+	s, err := ResolveMAC(DefaultSpec, "iso9797-alg3", hex.EncodeToString(testMACKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.MAC.Algorithm != mac.ISO9797Alg3 || !bytes.Equal(s.MAC.Key, testMACKey) || DefaultSpec.MAC != nil {
+		t.Fatalf("MAC = %+v, default %+v", s.MAC, DefaultSpec.MAC)
+	}
+	p, err := macRequest().Pack(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.VerifyMAC(p); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, args := range map[string][2]string{
+		"algorithm": {"cmac", "00"},
+		"no key":    {"x9.9", ""},
+		"bad hex":   {"x9.9", "xyz"},
+		"no config": {"", hex.EncodeToString(testMACKey)},
+	} {
+		if _, err := ResolveMAC(DefaultSpec, args[0], args[1]); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package iso8583
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// redacted replaces the value of SensRedact fields.
+const redacted = "[redacted]"
+
+// fieldKeyData is DE48, which carries working-key material in network
+// management key exchanges.
+const fieldKeyData = 48
+
+// MaskPAN shows at most the first 6 and last 4 digits of a card number,
+// fewer for short values, and replaces the rest with '*'.
+func MaskPAN(pan string) string {
+	n := len(pan)
+	switch {
+	case n > 10:
+		return pan[:6] + strings.Repeat("*", n-10) + pan[n-4:]
+	case n > 4:
+		return strings.Repeat("*", n-4) + pan[n-4:]
+	}
+	return strings.Repeat("*", n)
+}
+
+// Redacted returns a copy of the fields in display form (see Value.String)
+// with cardholder data masked according to the sensitivity in the
+// message's spec (see Message.Spec). Use it for anything that leaves the
+// process: logs, admin output, journals. The key material in DE48 of a
+// key exchange is always redacted.
+func (m *Message) Redacted() map[int]string {
+	spec := m.Spec()
+	keys := m.keyExchange()
+	out := make(map[int]string, len(m.Fields))
+	for f, v := range m.Fields {
+		switch {
+		case keys && f == fieldKeyData:
+			v = redacted
+		case spec.sensitivity(f) == SensPAN:
+			v = MaskPAN(v)
+		case spec.sensitivity(f) == SensRedact:
+			v = redacted
+		default:
+			v = Value{raw: v, kind: spec.kindOf(f)}.String()
+		}
+		out[f] = v
+	}
+	return out
+}
+
+// keyExchange reports whether m is a network management message (x8xx)
+// with a key management code (1xx) in DE70.
+func (m *Message) keyExchange() bool {
+	code, _ := m.Get(70)
+	return len(m.MTI) == 4 && m.MTI[1] == '8' && len(code) == 3 && code[0] == '1'
+}
+
+// String formats the MTI and the redacted fields in field order, e.g.
+// "0200 2=411111******1111 3=000000 35=[redacted]".
+func (m *Message) String() string {
+	fields := m.Redacted()
+	nums := make([]int, 0, len(fields))
+	for f := range fields {
+		nums = append(nums, f)
+	}
+	sort.Ints(nums)
+	var b strings.Builder
+	b.WriteString(m.MTI)
+	for _, f := range nums {
+		fmt.Fprintf(&b, " %d=%s", f, fields[f])
+	}
+	return b.String()
+}
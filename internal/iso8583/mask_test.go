@@ -0,0 +1,106 @@
+package iso8583
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testPAN = "4761739001010119"
+
+func cardMessage() *Message {
+	m := New("0200")
+	m.Set(2, testPAN)
+	m.Set(3, "000000")
+	m.Set(14, "2912")
+	m.Set(35, testPAN+"=29122011758928889")
+	m.Set(45, "B"+testPAN+"^CARDHOLDER/TEST^2912201")
+	m.Set(52, "0123456789ABCDEF")
+	m.Set(55, "9F2608C2A1B3E4F5A6B7C8")
+	return m
+}
+
+func TestMaskPAN(t *testing.T) {
+	cases := map[string]string{
+		testPAN:               "476173******0119",
+		"5500000000000004":    "550000******0004",
+		"4111111111111111111": "411111*********1111",
+		"12345678":            "****5678",
+		"123":                 "***",
+	}
+	for in, want := range cases {
+		if got := MaskPAN(in); got != want {
+			t.Errorf("MaskPAN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactedHidesCardholderData(t *testing.T) {
+	m := cardMessage()
+	r := m.Redacted()
+	if r[2] != "476173******0119" {
+		t.Fatalf("DE2 = %q", r[2])
+	}
+	for _, f := range []int{14, 35, 45, 52, 55} {
+		if r[f] != redacted {
+			t.Fatalf("DE%d = %q", f, r[f])
+		}
+	}
+	if r[3] != "000000" {
+		t.Fatalf("DE3 = %q", r[3])
+	}
+	if m.Fields[2] != testPAN {
+		t.Fatalf("Redacted modified the message")
+	}
+}
+
+func TestNoFullPANInFormattedOutput(t *testing.T) {
+	m := cardMessage()
+	outputs := []string{
+		m.String(),
+		fmt.Sprint(m),
+		fmt.Sprintf("%v", m),
+		fmt.Sprintf("%+v", m),
+		fmt.Sprintf("%s", m),
+		fmt.Sprintf("%v", m.Redacted()),
+	}
+
+	// A message unpacked with a spec that sets no sensitivity still falls
+	// back to CommonSpec.
+	spec := &Spec{Name: "bare", Charset: CharsetASCII, Fields: map[int]FieldSpec{}}
+	for f, fs := range CommonSpec {
+		fs.Sensitive = SensDefault
+		spec.Fields[f] = fs
+	}
+	b, err := m.Pack(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := Unpack(spec, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs = append(outputs, u.String())
+
+	for _, out := range outputs {
+		if strings.Contains(out, testPAN) || strings.Contains(out, "0123456789ABCDEF") {
+			t.Fatalf("cardholder data leaked: %s", out)
+		}
+	}
+}
+
+func TestSensitivityOverride(t *testing.T) {
+	spec := &Spec{Name: "clear", Charset: CharsetASCII, Fields: map[int]FieldSpec{
+		3: {Num: 3, Name: "ProcessingCode", Codec: FmtFixedNum, Len: 6, Sensitive: SensRedact},
+	}}
+	m := New("0200")
+	m.Set(3, "000000")
+	b, _ := m.Pack(spec)
+	u, err := Unpack(spec, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Redacted()[3]; got != redacted {
+		t.Fatalf("DE3 = %q", got)
+	}
+}
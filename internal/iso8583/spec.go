@@ -4,52 +4,140 @@ package iso8583
 type FieldCodec int
 
 const (
-	FmtFixedNum FieldCodec = iota // ASCII numeric fixed
-	FmtFixedAns                   // ASCII ans fixed
-	FmtLLVAR                      // ASCII ans LLVAR
-	FmtLLLVAR                     // ASCII ans LLLVAR
+	FmtFixedNum  FieldCodec = iota // ASCII numeric fixed
+	FmtFixedAns                    // ASCII ans fixed
+	FmtLLVAR                       // ASCII ans LLVAR
+	FmtLLLVAR                      // ASCII ans LLLVAR
+	FmtBCDNum                      // packed BCD numeric fixed, Len in digits
+	FmtBinary                      // binary fixed, Len in bytes
+	FmtBCDLLVAR                    // 1-byte BCD length, character (not BCD) data
+	FmtBCDLLLVAR                   // 2-byte BCD length, character (not BCD) data
+	FmtBinLLVAR                    // 1-byte binary length, raw data
+	FmtBinLLLVAR                   // 2-byte big-endian binary length, raw data
+	FmtBCDLLNum                    // 1-byte BCD length in digits, packed BCD digits
+	FmtBCDLLLNum                   // 2-byte BCD length in digits, packed BCD digits
+)
+
+// Padding selects where the filler nibble goes when an odd number of
+// digits is packed as BCD.
+type Padding int
+
+const (
+	PadLeft  Padding = iota // filler before the first digit
+	PadRight                // filler after the last digit
+)
+
+// Sensitivity controls how a field is shown by Message.Redacted and
+// Message.String.
+type Sensitivity int
+
+const (
+	SensDefault Sensitivity = iota // as the CommonSpec field with the same number
+	SensClear                      // shown as is
+	SensPAN                        // first 6 and last 4 digits shown
+	SensRedact                     // value hidden entirely
 )
 
 // FieldSpec describes an ISO8583 data element.
 type FieldSpec struct {
-	Num   int
-	Name  string
-	Codec FieldCodec
-	Len   int // length for fixed fields
+	Num     int        `json:"num"`
+	Name    string     `json:"name"`
+	Codec   FieldCodec `json:"codec"`
+	Len     int        `json:"len,omitempty"`     // length for fixed fields
+	MaxLen  int        `json:"max_len,omitempty"` // optional cap for variable fields, 0 = prefix limit
+	Pad     Padding    `json:"pad,omitempty"`     // BCD filler position for odd lengths (bcd-num, bcd-llnum, bcd-lllnum)
+	Charset Charset    `json:"charset,omitempty"` // overrides Spec.Charset when set
+	// Class restricts the characters Pack and Unpack accept; Luhn also
+	// requires a valid check digit, e.g. for a PAN.
+	Class ContentClass `json:"class,omitempty"`
+	Luhn  bool         `json:"luhn,omitempty"`
+	// Sensitive marks cardholder data to mask in logs and admin output.
+	Sensitive Sensitivity `json:"sensitive,omitempty"`
+	// Sub splits the value into sub-elements for Message.GetSub.
+	Sub *SubLayout `json:"sub,omitempty"`
+}
+
+// Spec is a complete message layout: the field table plus the character
+// and bitmap encodings shared by every message. Specs can be loaded from
+// JSON with LoadSpec.
+type Spec struct {
+	Name    string
+	Fields  map[int]FieldSpec
+	Charset Charset
+	Bitmap  BitmapEncoding
+	// TertiaryBitmap enables fields 129-192. Bit 65 then flags the
+	// tertiary bitmap and DE65 cannot carry data.
+	TertiaryBitmap bool
+	// MAC, once given a key with WithMACKey, makes Pack add a MAC and
+	// enables VerifyMAC.
+	MAC *MACConfig
+}
+
+// maxField is the highest field number the spec's bitmaps can address.
+func (s *Spec) maxField() int {
+	if s.TertiaryBitmap {
+		return 192
+	}
+	return 128
+}
+
+// DefaultSpec wraps CommonSpec. Pack and Unpack fall back to it when given
+// a nil spec.
+var DefaultSpec = &Spec{Name: "common", Fields: CommonSpec, Charset: CharsetASCII}
+
+// charsetFor returns the character encoding used for field fs.
+func (s *Spec) charsetFor(fs FieldSpec) Charset {
+	if fs.Charset != 0 {
+		return fs.Charset
+	}
+	return s.Charset
+}
+
+// sensitivity returns how field f is masked. Fields without an explicit
+// setting fall back to CommonSpec, so custom specs stay safe by default.
+func (s *Spec) sensitivity(f int) Sensitivity {
+	if fs, ok := s.Fields[f]; ok && fs.Sensitive != SensDefault {
+		return fs.Sensitive
+	}
+	return CommonSpec[f].Sensitive
 }
 
 // CommonSpec lists common ISO8583 fields supported by this package.
 var CommonSpec = map[int]FieldSpec{
-	2:   {2, "PAN", FmtLLVAR, 0},
-	3:   {3, "ProcessingCode", FmtFixedNum, 6},
-	4:   {4, "Amount", FmtFixedNum, 12},
-	7:   {7, "TransmissionDateTime", FmtFixedNum, 10},
-	11:  {11, "STAN", FmtFixedNum, 6},
-	12:  {12, "LocalTime", FmtFixedNum, 6},
-	13:  {13, "LocalDate", FmtFixedNum, 4},
-	14:  {14, "Expiry", FmtFixedNum, 4},
-	22:  {22, "POSEntryMode", FmtFixedNum, 3},
-	23:  {23, "PANSeq", FmtFixedNum, 3},
-	24:  {24, "NII", FmtFixedNum, 3},
-	25:  {25, "POSCond", FmtFixedNum, 2},
-	32:  {32, "AcqInstID", FmtLLVAR, 0},
-	35:  {35, "Track2", FmtLLVAR, 0},
-	37:  {37, "RRN", FmtFixedAns, 12},
-	38:  {38, "AuthID", FmtFixedAns, 6},
-	39:  {39, "RespCode", FmtFixedAns, 2},
-	41:  {41, "TermID", FmtFixedAns, 8},
-	42:  {42, "MerchID", FmtFixedAns, 15},
-	43:  {43, "MerchLoc", FmtFixedAns, 40},
-	48:  {48, "AddlDataPriv", FmtLLLVAR, 0},
-	49:  {49, "Currency", FmtFixedAns, 3},
-	52:  {52, "PINBlock", FmtFixedAns, 16},
-	53:  {53, "SecCtrl", FmtFixedNum, 16},
-	54:  {54, "AddlAmounts", FmtLLLVAR, 0},
-	55:  {55, "ICCData", FmtLLLVAR, 0},
-	60:  {60, "AdviceReason/Priv", FmtLLLVAR, 0},
-	61:  {61, "POSExt", FmtLLLVAR, 0},
-	62:  {62, "Priv", FmtLLLVAR, 0},
-	63:  {63, "Priv2", FmtLLLVAR, 0},
-	70:  {70, "NMMCode", FmtFixedNum, 3},
-	102: {102, "AccountID1", FmtLLVAR, 0},
+	2:   {Num: 2, Name: "PAN", Codec: FmtLLVAR, Class: ClassN, Sensitive: SensPAN},
+	3:   {Num: 3, Name: "ProcessingCode", Codec: FmtFixedNum, Len: 6, Class: ClassN},
+	4:   {Num: 4, Name: "Amount", Codec: FmtFixedNum, Len: 12, Class: ClassN},
+	7:   {Num: 7, Name: "TransmissionDateTime", Codec: FmtFixedNum, Len: 10, Class: ClassN},
+	11:  {Num: 11, Name: "STAN", Codec: FmtFixedNum, Len: 6, Class: ClassN},
+	12:  {Num: 12, Name: "LocalTime", Codec: FmtFixedNum, Len: 6, Class: ClassN},
+	13:  {Num: 13, Name: "LocalDate", Codec: FmtFixedNum, Len: 4, Class: ClassN},
+	14:  {Num: 14, Name: "Expiry", Codec: FmtFixedNum, Len: 4, Class: ClassN, Sensitive: SensRedact},
+	22:  {Num: 22, Name: "POSEntryMode", Codec: FmtFixedNum, Len: 3, Class: ClassN},
+	23:  {Num: 23, Name: "PANSeq", Codec: FmtFixedNum, Len: 3, Class: ClassN},
+	24:  {Num: 24, Name: "NII", Codec: FmtFixedNum, Len: 3, Class: ClassN},
+	25:  {Num: 25, Name: "POSCond", Codec: FmtFixedNum, Len: 2, Class: ClassN},
+	32:  {Num: 32, Name: "AcqInstID", Codec: FmtLLVAR, Class: ClassN},
+	35:  {Num: 35, Name: "Track2", Codec: FmtLLVAR, Class: ClassZ, Sensitive: SensRedact},
+	37:  {Num: 37, Name: "RRN", Codec: FmtFixedAns, Len: 12, Class: ClassAN},
+	38:  {Num: 38, Name: "AuthID", Codec: FmtFixedAns, Len: 6, Class: ClassAN},
+	39:  {Num: 39, Name: "RespCode", Codec: FmtFixedAns, Len: 2, Class: ClassAN},
+	41:  {Num: 41, Name: "TermID", Codec: FmtFixedAns, Len: 8, Class: ClassANS},
+	42:  {Num: 42, Name: "MerchID", Codec: FmtFixedAns, Len: 15, Class: ClassANS},
+	43:  {Num: 43, Name: "MerchLoc", Codec: FmtFixedAns, Len: 40, Class: ClassANS},
+	45:  {Num: 45, Name: "Track1", Codec: FmtLLVAR, MaxLen: 76, Class: ClassANS, Sensitive: SensRedact},
+	48:  {Num: 48, Name: "AddlDataPriv", Codec: FmtLLLVAR, Class: ClassANS, Sub: &SubLayout{Kind: SubTLV, TagLen: 2}},
+	49:  {Num: 49, Name: "Currency", Codec: FmtFixedAns, Len: 3, Class: ClassAN},
+	52:  {Num: 52, Name: "PINBlock", Codec: FmtFixedAns, Len: 16, Class: ClassH, Sensitive: SensRedact},
+	53:  {Num: 53, Name: "SecCtrl", Codec: FmtFixedNum, Len: 16, Class: ClassN},
+	54:  {Num: 54, Name: "AddlAmounts", Codec: FmtLLLVAR, Class: ClassANS},
+	55:  {Num: 55, Name: "ICCData", Codec: FmtLLLVAR, Class: ClassB, Sensitive: SensRedact},
+	60:  {Num: 60, Name: "AdviceReason/Priv", Codec: FmtLLLVAR, Class: ClassANS},
+	61:  {Num: 61, Name: "POSExt", Codec: FmtLLLVAR, Class: ClassANS},
+	62:  {Num: 62, Name: "Priv", Codec: FmtLLLVAR, Class: ClassANS},
+	63:  {Num: 63, Name: "Priv2", Codec: FmtLLLVAR, Class: ClassANS},
+	64:  {Num: 64, Name: "MAC", Codec: FmtFixedAns, Len: 16, Class: ClassH},
+	70:  {Num: 70, Name: "NMMCode", Codec: FmtFixedNum, Len: 3, Class: ClassN},
+	90:  {Num: 90, Name: "OrigDataElements", Codec: FmtFixedNum, Len: 42, Class: ClassN},
+	102: {Num: 102, Name: "AccountID1", Codec: FmtLLVAR, Class: ClassANS, Sensitive: SensPAN},
+	128: {Num: 128, Name: "MAC2", Codec: FmtFixedAns, Len: 16, Class: ClassH},
 }
@@ -0,0 +1,319 @@
+package iso8583
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go-payment-gateway/internal/mac"
+)
+
+var codecNames = map[FieldCodec]string{
+	FmtFixedNum:  "fixed-num",
+	FmtFixedAns:  "fixed-ans",
+	FmtLLVAR:     "llvar",
+	FmtLLLVAR:    "lllvar",
+	FmtBCDNum:    "bcd-num",
+	FmtBinary:    "binary",
+	FmtBCDLLVAR:  "bcd-llvar",
+	FmtBCDLLLVAR: "bcd-lllvar",
+	FmtBinLLVAR:  "bin-llvar",
+	FmtBinLLLVAR: "bin-lllvar",
+	FmtBCDLLNum:  "bcd-llnum",
+	FmtBCDLLLNum: "bcd-lllnum",
+}
+
+func (c FieldCodec) String() string {
+	if n, ok := codecNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("FieldCodec(%d)", int(c))
+}
+
+func (c FieldCodec) MarshalText() ([]byte, error) { return []byte(c.String()), nil }
+
+func (c *FieldCodec) UnmarshalText(b []byte) error {
+	for k, n := range codecNames {
+		if n == string(b) {
+			*c = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown codec %q", b)
+}
+
+func (p Padding) String() string {
+	if p == PadRight {
+		return "right"
+	}
+	return "left"
+}
+
+func (p Padding) MarshalText() ([]byte, error) { return []byte(p.String()), nil }
+
+func (p *Padding) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "left", "":
+		*p = PadLeft
+	case "right":
+		*p = PadRight
+	default:
+		return fmt.Errorf("unknown padding %q", b)
+	}
+	return nil
+}
+
+var sensitivityNames = map[Sensitivity]string{
+	SensDefault: "default",
+	SensClear:   "clear",
+	SensPAN:     "pan",
+	SensRedact:  "redact",
+}
+
+func (s Sensitivity) String() string { return sensitivityNames[s] }
+
+func (s Sensitivity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+func (s *Sensitivity) UnmarshalText(b []byte) error {
+	for k, n := range sensitivityNames {
+		if n == string(b) {
+			*s = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown sensitivity %q", b)
+}
+
+var classNames = map[ContentClass]string{
+	ClassAny: "",
+	ClassN:   "n",
+	ClassA:   "a",
+	ClassAN:  "an",
+	ClassANS: "ans",
+	ClassB:   "b",
+	ClassZ:   "z",
+	ClassXN:  "x+n",
+	ClassH:   "h",
+}
+
+func (c ContentClass) String() string {
+	if n, ok := classNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("ContentClass(%d)", int(c))
+}
+
+func (c ContentClass) MarshalText() ([]byte, error) { return []byte(c.String()), nil }
+
+func (c *ContentClass) UnmarshalText(b []byte) error {
+	for k, n := range classNames {
+		if n == string(b) {
+			*c = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown content class %q", b)
+}
+
+var subKindNames = map[SubKind]string{
+	SubPositional: "positional",
+	SubTLV:        "tlv",
+	SubBitmap:     "bitmap",
+}
+
+func (k SubKind) String() string {
+	if n, ok := subKindNames[k]; ok {
+		return n
+	}
+	return fmt.Sprintf("SubKind(%d)", int(k))
+}
+
+func (k SubKind) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+
+func (k *SubKind) UnmarshalText(b []byte) error {
+	for v, n := range subKindNames {
+		if n == string(b) {
+			*k = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown sub-field kind %q", b)
+}
+
+// specFile is the JSON layout of a spec file:
+//
+//	{
+//	  "name": "local-switch",
+//	  "charset": "cp037",
+//	  "bitmap": "ebcdic-hex",
+//	  "tertiary_bitmap": false,
+//	  "mac": {"algorithm": "x9.19", "fields": [0, 2, 3, 4, 11, 41]},
+//	  "fields": [
+//	    {"num": 2, "name": "PAN", "codec": "bcd-llnum", "max_len": 19, "class": "n", "luhn": true, "sensitive": "pan"},
+//	    {"num": 3, "name": "ProcessingCode", "codec": "bcd-num", "len": 6, "class": "n"},
+//	    {"num": 48, "name": "AddlDataPriv", "codec": "lllvar",
+//	     "sub": {"kind": "tlv", "tag_len": 2, "len_len": 2}}
+//	  ]
+//	}
+type specFile struct {
+	Name           string         `json:"name"`
+	Charset        Charset        `json:"charset,omitempty"`
+	Bitmap         BitmapEncoding `json:"bitmap,omitempty"`
+	TertiaryBitmap bool           `json:"tertiary_bitmap,omitempty"`
+	MAC            *MACConfig     `json:"mac,omitempty"`
+	Fields         []FieldSpec    `json:"fields"`
+}
+
+// ParseSpec reads a JSON spec definition.
+func ParseSpec(r io.Reader) (*Spec, error) {
+	var f specFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	s := &Spec{
+		Name:           f.Name,
+		Fields:         make(map[int]FieldSpec, len(f.Fields)),
+		Charset:        f.Charset,
+		Bitmap:         f.Bitmap,
+		TertiaryBitmap: f.TertiaryBitmap,
+		MAC:            f.MAC,
+	}
+	if s.Charset == 0 {
+		s.Charset = CharsetASCII
+	}
+	for _, fs := range f.Fields {
+		if _, dup := s.Fields[fs.Num]; dup {
+			return nil, fmt.Errorf("DE%d defined twice", fs.Num)
+		}
+		s.Fields[fs.Num] = fs
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadSpec reads a JSON spec definition from path.
+func LoadSpec(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ParseSpec(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ResolveSpec returns the spec loaded from path, or DefaultSpec if path is
+// empty, with its charset replaced when charset is non-empty. It backs the
+// -spec and -charset command-line flags.
+func ResolveSpec(path, charset string) (*Spec, error) {
+	spec := DefaultSpec
+	if path != "" {
+		s, err := LoadSpec(path)
+		if err != nil {
+			return nil, err
+		}
+		spec = s
+	}
+	if charset != "" {
+		cs, err := ParseCharset(charset)
+		if err != nil {
+			return nil, err
+		}
+		c := *spec
+		c.Charset = cs
+		spec = &c
+	}
+	return spec, nil
+}
+
+// ResolveMAC applies the -mac and -mac-key command-line flags to spec:
+// algorithm, if set, replaces the spec's MAC algorithm, and keyHex enables
+// MACs with that key. It returns spec itself when both are empty.
+func ResolveMAC(spec *Spec, algorithm, keyHex string) (*Spec, error) {
+	if algorithm != "" {
+		alg, err := mac.ParseAlgorithm(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		c := *spec
+		cfg := MACConfig{}
+		if spec.MAC != nil {
+			cfg = *spec.MAC
+		}
+		cfg.Algorithm = alg
+		c.MAC = &cfg
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		spec = &c
+	}
+	if keyHex == "" {
+		if algorithm != "" {
+			return nil, errors.New("MAC algorithm set without a key")
+		}
+		return spec, nil
+	}
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, fmt.Errorf("MAC key: %w", err)
+	}
+	return spec.WithMACKey(key)
+}
+
+// Validate checks that every field definition can be packed.
+func (s *Spec) Validate() error {
+	if _, ok := bitmapNames[s.Bitmap]; !ok {
+		return fmt.Errorf("unknown bitmap encoding %d", s.Bitmap)
+	}
+	for n, fs := range s.Fields {
+		if n != fs.Num {
+			return fmt.Errorf("DE%d listed under key %d", fs.Num, n)
+		}
+		if n < 2 || n > s.maxField() {
+			return fmt.Errorf("DE%d out of range", n)
+		}
+		if n == 65 && s.TertiaryBitmap {
+			return fmt.Errorf("DE65 is the tertiary bitmap indicator")
+		}
+		if _, ok := codecNames[fs.Codec]; !ok {
+			return fmt.Errorf("DE%d: unknown codec %d", n, fs.Codec)
+		}
+		if _, ok := classNames[fs.Class]; !ok {
+			return fmt.Errorf("DE%d: unknown content class %d", n, fs.Class)
+		}
+		switch fs.Codec {
+		case FmtFixedNum, FmtFixedAns, FmtBCDNum, FmtBinary:
+			if fs.Len <= 0 {
+				return fmt.Errorf("DE%d: fixed codec %s needs len", n, fs.Codec)
+			}
+		default:
+			if fs.Len != 0 {
+				return fmt.Errorf("DE%d: variable codec %s takes max_len, not len", n, fs.Codec)
+			}
+			if p, _ := prefixFor(fs.Codec); fs.MaxLen > p.limit {
+				return fmt.Errorf("DE%d: max_len %d exceeds %s limit %d", n, fs.MaxLen, fs.Codec, p.limit)
+			}
+		}
+		if fs.Sub != nil {
+			if err := fs.Sub.validate(fs.Class); err != nil {
+				return fmt.Errorf("DE%d: %w", n, err)
+			}
+		}
+	}
+	if s.MAC != nil {
+		if err := s.MAC.validate(s); err != nil {
+			return fmt.Errorf("mac: %w", err)
+		}
+	}
+	return nil
+}
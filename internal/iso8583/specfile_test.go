@@ -0,0 +1,61 @@
+package iso8583
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommonSpecFileMatchesBuiltin(t *testing.T) {
+	s, err := LoadSpec("../../specs/common.json")
+	if err != nil {
+		t.Fatalf("LoadSpec: %v", err)
+	}
+	if !reflect.DeepEqual(s.Fields, CommonSpec) {
+		t.Fatalf("specs/common.json is out of sync with CommonSpec")
+	}
+	if s.Charset != CharsetASCII {
+		t.Fatalf("charset %v", s.Charset)
+	}
+}
+
+func TestLoadedSpecRoundTrip(t *testing.T) {
+	s, err := LoadSpec("../../specs/bcd-switch.json")
+	if err != nil {
+		t.Fatalf("LoadSpec: %v", err)
+	}
+	m := NewEchoRequest(12)
+	m.Set(2, "4111111111111111")
+	p, err := m.Pack(s)
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	m2, err := Unpack(s, p)
+	if err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if !reflect.DeepEqual(m.Fields, m2.Fields) {
+		t.Fatalf("roundtrip got %v want %v", m2.Fields, m.Fields)
+	}
+}
+
+func TestParseSpecErrors(t *testing.T) {
+	for name, in := range map[string]string{
+		"unknown codec":   `{"fields":[{"num":2,"codec":"zoned"}]}`,
+		"fixed no len":    `{"fields":[{"num":3,"codec":"fixed-num"}]}`,
+		"duplicate":       `{"fields":[{"num":3,"codec":"bcd-num","len":6},{"num":3,"codec":"bcd-num","len":6}]}`,
+		"out of range":    `{"fields":[{"num":1,"codec":"binary","len":8}]}`,
+		"max over prefix": `{"fields":[{"num":2,"codec":"llvar","max_len":100}]}`,
+		"bad charset":     `{"charset":"utf8","fields":[]}`,
+		"unknown key":     `{"fields":[{"num":2,"codec":"llvar","size":3}]}`,
+		"sub tag_len":     `{"fields":[{"num":48,"codec":"lllvar","sub":{"kind":"tlv","tag_len":4}}]}`,
+		"sub kind":        `{"fields":[{"num":48,"codec":"lllvar","sub":{"kind":"nested"}}]}`,
+		"sub bit":         `{"fields":[{"num":62,"codec":"lllvar","sub":{"kind":"bitmap","fields":[{"id":"65","len":2}]}}]}`,
+		"sub no len":      `{"fields":[{"num":60,"codec":"lllvar","sub":{"kind":"positional","fields":[{"id":"a"}]}}]}`,
+		"sub bitmap ans":  `{"fields":[{"num":62,"codec":"lllvar","class":"ans","sub":{"kind":"bitmap","fields":[{"id":"1","len":2}]}}]}`,
+	} {
+		if _, err := ParseSpec(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package iso8583
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SubKind selects how a field's value is split into sub-elements.
+type SubKind int
+
+const (
+	SubPositional SubKind = iota + 1 // elements one after another, in layout order
+	SubTLV                           // tag, decimal length, value; in any order
+	SubBitmap                        // a 64-bit bitmap, then the flagged elements
+)
+
+// SubLayout describes the sub-elements inside a field's value, usually a
+// private-use field such as DE48 or DE60-DE63.
+type SubLayout struct {
+	Kind SubKind `json:"kind"`
+	// TagLen and LenLen are the sizes of a TLV element's tag (2 or 3
+	// characters) and length (1 to 3 digits, 2 if unset).
+	TagLen int `json:"tag_len,omitempty"`
+	LenLen int `json:"len_len,omitempty"`
+	// Bitmap is the encoding of a SubBitmap layout's bitmap: binary or hex.
+	Bitmap BitmapEncoding `json:"bitmap,omitempty"`
+	// Fields lists the elements. Positional elements are identified by
+	// name, bitmapped ones by bit number ("1" to "64") and TLV ones by
+	// tag; TLV fields are optional and only name the tags.
+	Fields []SubField `json:"fields,omitempty"`
+}
+
+// SubField describes one sub-element.
+type SubField struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Len  int    `json:"len,omitempty"` // fixed length in characters
+	// LenDigits makes the element variable, prefixed by its length in this
+	// many decimal digits.
+	LenDigits int `json:"len_digits,omitempty"`
+}
+
+func (l *SubLayout) lenLen() int {
+	if l.LenLen == 0 {
+		return 2
+	}
+	return l.LenLen
+}
+
+func (l *SubLayout) field(id string) (SubField, bool) {
+	for _, sf := range l.Fields {
+		if sf.ID == id {
+			return sf, true
+		}
+	}
+	return SubField{}, false
+}
+
+// validate checks that the layout can be packed inside a field of the
+// given content class.
+func (l *SubLayout) validate(class ContentClass) error {
+	seen := make(map[string]bool, len(l.Fields))
+	for _, sf := range l.Fields {
+		if seen[sf.ID] {
+			return fmt.Errorf("sub-field %q defined twice", sf.ID)
+		}
+		seen[sf.ID] = true
+		if l.Kind != SubTLV && (sf.Len > 0) == (sf.LenDigits > 0) {
+			return fmt.Errorf("sub-field %q needs exactly one of len and len_digits", sf.ID)
+		}
+		if sf.LenDigits > 3 {
+			return fmt.Errorf("sub-field %q: len_digits %d above 3", sf.ID, sf.LenDigits)
+		}
+		if l.Kind == SubBitmap {
+			if bit, err := strconv.Atoi(sf.ID); err != nil || bit < 1 || bit > 64 {
+				return fmt.Errorf("sub-field %q: bitmapped ids are bits 1 to 64", sf.ID)
+			}
+		}
+	}
+	switch l.Kind {
+	case SubPositional:
+	case SubTLV:
+		if l.TagLen != 2 && l.TagLen != 3 {
+			return fmt.Errorf("tlv tag_len must be 2 or 3")
+		}
+		if n := l.lenLen(); n < 1 || n > 3 {
+			return fmt.Errorf("tlv len_len must be 1 to 3")
+		}
+		for _, sf := range l.Fields {
+			if len(sf.ID) != l.TagLen {
+				return fmt.Errorf("tlv tag %q is not %d characters", sf.ID, l.TagLen)
+			}
+		}
+	case SubBitmap:
+		if l.Bitmap != BitmapBinary && l.Bitmap != BitmapHex {
+			return fmt.Errorf("sub-field bitmap must be binary or hex")
+		}
+		// A binary bitmap would fail any character class check.
+		if l.Bitmap == BitmapBinary && class != ClassB && class != ClassAny {
+			return fmt.Errorf("binary sub-field bitmap needs a class b field, not %s; use a hex bitmap", class)
+		}
+	default:
+		return fmt.Errorf("unknown sub-field kind %d", l.Kind)
+	}
+	return nil
+}
+
+// unpack splits v into its sub-elements.
+func (l *SubLayout) unpack(v string) (map[string]string, error) {
+	out := make(map[string]string)
+	switch l.Kind {
+	case SubPositional:
+		off := 0
+		for _, sf := range l.Fields {
+			if off == len(v) {
+				break // trailing elements may be left out
+			}
+			s, err := readSub(v, &off, sf)
+			if err != nil {
+				return nil, err
+			}
+			out[sf.ID] = s
+		}
+		if off != len(v) {
+			return nil, fmt.Errorf("%d extra characters", len(v)-off)
+		}
+	case SubTLV:
+		for off := 0; off < len(v); {
+			if off+l.TagLen > len(v) {
+				return nil, fmt.Errorf("tag truncated at %d", off)
+			}
+			tag := v[off : off+l.TagLen]
+			off += l.TagLen
+			s, err := readSub(v, &off, SubField{ID: tag, LenDigits: l.lenLen()})
+			if err != nil {
+				return nil, err
+			}
+			out[tag] = s
+		}
+	case SubBitmap:
+		off := 0
+		bm, err := l.Bitmap.read([]byte(v), &off)
+		if err != nil {
+			return nil, err
+		}
+		for bit := 1; bit <= 64; bit++ {
+			if bm&(1<<(64-bit)) == 0 {
+				continue
+			}
+			id := strconv.Itoa(bit)
+			sf, ok := l.field(id)
+			if !ok {
+				return nil, fmt.Errorf("bit %s set but not in layout", id)
+			}
+			s, err := readSub(v, &off, sf)
+			if err != nil {
+				return nil, err
+			}
+			out[id] = s
+		}
+		if off != len(v) {
+			return nil, fmt.Errorf("%d extra characters", len(v)-off)
+		}
+	}
+	return out, nil
+}
+
+// pack joins sub-elements into a field value. Positional elements that are
+// missing are space-filled up to the last present one; TLV elements are
+// written in tag order.
+func (l *SubLayout) pack(subs map[string]string) (string, error) {
+	var b strings.Builder
+	switch l.Kind {
+	case SubPositional:
+		last := -1
+		for i, sf := range l.Fields {
+			if _, ok := subs[sf.ID]; ok {
+				last = i
+			}
+		}
+		if err := unknownSub(l, subs); err != nil {
+			return "", err
+		}
+		for _, sf := range l.Fields[:last+1] {
+			if err := writeSub(&b, sf, subs[sf.ID]); err != nil {
+				return "", err
+			}
+		}
+	case SubTLV:
+		tags := make([]string, 0, len(subs))
+		for tag := range subs {
+			if len(tag) != l.TagLen {
+				return "", fmt.Errorf("tag %q is not %d characters", tag, l.TagLen)
+			}
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			b.WriteString(tag)
+			if err := writeSub(&b, SubField{ID: tag, LenDigits: l.lenLen()}, subs[tag]); err != nil {
+				return "", err
+			}
+		}
+	case SubBitmap:
+		if err := unknownSub(l, subs); err != nil {
+			return "", err
+		}
+		var bm uint64
+		var body strings.Builder
+		for bit := 1; bit <= 64; bit++ {
+			sf, ok := l.field(strconv.Itoa(bit))
+			if !ok {
+				continue
+			}
+			s, ok := subs[sf.ID]
+			if !ok {
+				continue
+			}
+			bm |= 1 << (64 - bit)
+			if err := writeSub(&body, sf, s); err != nil {
+				return "", err
+			}
+		}
+		b.Write(l.Bitmap.write(nil, bm))
+		b.WriteString(body.String())
+	}
+	return b.String(), nil
+}
+
+func unknownSub(l *SubLayout, subs map[string]string) error {
+	for id := range subs {
+		if _, ok := l.field(id); !ok {
+			return fmt.Errorf("sub-field %q not in layout", id)
+		}
+	}
+	return nil
+}
+
+func readSub(v string, off *int, sf SubField) (string, error) {
+	n := sf.Len
+	if sf.LenDigits > 0 {
+		if *off+sf.LenDigits > len(v) {
+			return "", fmt.Errorf("sub-field %s: length truncated", sf.ID)
+		}
+		var err error
+		if n, err = strconv.Atoi(v[*off : *off+sf.LenDigits]); err != nil || n < 0 {
+			return "", fmt.Errorf("sub-field %s: invalid length %q", sf.ID, v[*off:*off+sf.LenDigits])
+		}
+		*off += sf.LenDigits
+	}
+	if *off+n > len(v) {
+		return "", fmt.Errorf("sub-field %s: truncated", sf.ID)
+	}
+	s := v[*off : *off+n]
+	*off += n
+	return s, nil
+}
+
+func writeSub(b *strings.Builder, sf SubField, s string) error {
+	if sf.LenDigits > 0 {
+		max := 1
+		for i := 0; i < sf.LenDigits; i++ {
+			max *= 10
+		}
+		if len(s) >= max {
+			return fmt.Errorf("sub-field %s: %d characters exceed %d-digit length", sf.ID, len(s), sf.LenDigits)
+		}
+		fmt.Fprintf(b, "%0*d%s", sf.LenDigits, len(s), s)
+		return nil
+	}
+	if len(s) > sf.Len {
+		return fmt.Errorf("sub-field %s: %d characters exceed length %d", sf.ID, len(s), sf.Len)
+	}
+	b.WriteString(s)
+	b.WriteString(strings.Repeat(" ", sf.Len-len(s)))
+	return nil
+}
+
+// subLayout returns the layout of field f in the message's spec.
+func (m *Message) subLayout(f int) (*SubLayout, error) {
+	l := m.Spec().Fields[f].Sub
+	if l == nil {
+		return nil, fmt.Errorf("DE%d has no sub-field layout", f)
+	}
+	return l, nil
+}
+
+// Subs returns the sub-elements of field f, split according to the
+// field's layout in the message's spec. A missing field has none.
+func (m *Message) Subs(f int) (map[string]string, error) {
+	l, err := m.subLayout(f)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := m.Get(f)
+	if !ok {
+		return map[string]string{}, nil
+	}
+	subs, err := l.unpack(v)
+	if err != nil {
+		return nil, fmt.Errorf("DE%d: %w", f, err)
+	}
+	return subs, nil
+}
+
+// SetSubs replaces field f with subs packed according to its layout, or
+// removes the field when subs is empty.
+func (m *Message) SetSubs(f int, subs map[string]string) error {
+	l, err := m.subLayout(f)
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		delete(m.Fields, f)
+		return nil
+	}
+	v, err := l.pack(subs)
+	if err != nil {
+		return fmt.Errorf("DE%d: %w", f, err)
+	}
+	m.Set(f, v)
+	return nil
+}
+
+// GetSub returns sub-element id of field f, e.g. GetSub(48, "61").
+func (m *Message) GetSub(f int, id string) (string, bool, error) {
+	subs, err := m.Subs(f)
+	if err != nil {
+		return "", false, err
+	}
+	v, ok := subs[id]
+	return v, ok, nil
+}
+
+// SetSub sets sub-element id of field f, keeping the others.
+func (m *Message) SetSub(f int, id, value string) error {
+	subs, err := m.Subs(f)
+	if err != nil {
+		return err
+	}
+	subs[id] = value
+	return m.SetSubs(f, subs)
+}
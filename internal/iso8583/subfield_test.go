@@ -0,0 +1,126 @@
+package iso8583
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubTLVOnDE48(t *testing.T) {
+	m := New("0100")
+	if err := m.SetSub(48, "61", "00001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetSub(48, "10", "X"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get(48); v != "1001X610500001" {
+		t.Fatalf("DE48 = %q", v)
+	}
+	p, err := m.Pack(DefaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unpack(DefaultSpec, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := got.GetSub(48, "61"); err != nil || !ok || v != "00001" {
+		t.Fatalf("GetSub = %q, %v, %v", v, ok, err)
+	}
+	if _, ok, _ := got.GetSub(48, "99"); ok {
+		t.Fatal("GetSub found absent tag")
+	}
+
+	got.Set(48, "6105001")
+	if _, _, err := got.GetSub(48, "61"); err == nil {
+		t.Fatal("expected error for truncated element")
+	}
+	if _, _, err := got.GetSub(3, "1"); err == nil {
+		t.Fatal("expected error for field without layout")
+	}
+}
+
+func subSpec(l *SubLayout) *Spec {
+	fields := map[int]FieldSpec{62: {Num: 62, Name: "Priv", Codec: FmtLLLVAR, Sub: l}}
+	return &Spec{Name: "sub", Fields: fields, Charset: CharsetASCII}
+}
+
+func TestSubPositional(t *testing.T) {
+	spec := subSpec(&SubLayout{Kind: SubPositional, Fields: []SubField{
+		{ID: "type", Len: 2},
+		{ID: "ref", LenDigits: 2},
+		{ID: "flag", Len: 1},
+	}})
+	if err := spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	m := New("0100")
+	m.SetSpec(spec)
+	if err := m.SetSubs(62, map[string]string{"type": "A", "ref": "XYZ"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := m.Get(62); v != "A 03XYZ" {
+		t.Fatalf("DE62 = %q", v)
+	}
+	subs, err := m.Subs(62)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"type": "A ", "ref": "XYZ"}; !reflect.DeepEqual(subs, want) {
+		t.Fatalf("Subs = %v, want %v", subs, want)
+	}
+	if err := m.SetSub(62, "type", "ABC"); err == nil {
+		t.Fatal("expected error for overlong element")
+	}
+	if err := m.SetSub(62, "nope", "1"); err == nil {
+		t.Fatal("expected error for unknown element")
+	}
+	m.Set(62, "A 03XYZYY")
+	if _, err := m.Subs(62); err == nil {
+		t.Fatal("expected error for extra data")
+	}
+}
+
+func TestSubBitmap(t *testing.T) {
+	for _, enc := range []BitmapEncoding{BitmapBinary, BitmapHex} {
+		spec := subSpec(&SubLayout{Kind: SubBitmap, Bitmap: enc, Fields: []SubField{
+			{ID: "1", Len: 1},
+			{ID: "3", Len: 4},
+			{ID: "64", LenDigits: 3},
+		}})
+		if err := spec.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		m := New("0100")
+		m.SetSpec(spec)
+		in := map[string]string{"3": "ABCD", "64": "tail"}
+		if err := m.SetSubs(62, in); err != nil {
+			t.Fatal(err)
+		}
+		v, _ := m.Get(62)
+		if enc == BitmapHex && !strings.HasPrefix(v, "2000000000000001ABCD004tail") {
+			t.Fatalf("DE62 = %q", v)
+		}
+		p, err := m.Pack(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Unpack(spec, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs, err := got.Subs(62)
+		if err != nil || !reflect.DeepEqual(subs, in) {
+			t.Fatalf("%s: Subs = %v, %v", enc, subs, err)
+		}
+	}
+
+	spec := subSpec(&SubLayout{Kind: SubBitmap, Bitmap: BitmapHex, Fields: []SubField{{ID: "1", Len: 1}}})
+	m := New("0100")
+	m.SetSpec(spec)
+	m.Set(62, "4000000000000000X")
+	if _, err := m.Subs(62); err == nil {
+		t.Fatal("expected error for bit outside layout")
+	}
+}
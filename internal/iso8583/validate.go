@@ -0,0 +1,133 @@
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ContentClass is the ISO8583 attribute restricting which characters a
+// field may hold.
+type ContentClass int
+
+const (
+	ClassAny ContentClass = iota // not checked
+	ClassN                       // digits
+	ClassA                       // letters and spaces
+	ClassAN                      // letters, digits and spaces
+	ClassANS                     // printable ASCII
+	ClassB                       // binary, not checked
+	ClassZ                       // track 2/3 code set: digits, '=', 'D' and ':;<>?'
+	ClassXN                      // 'C' (credit) or 'D' (debit), then digits
+	ClassH                       // hex digits standing for binary data, e.g. a PIN block
+)
+
+// Validation errors, wrapped in a FieldError.
+var (
+	ErrContent = errors.New("invalid content")
+	ErrLuhn    = errors.New("fails Luhn check")
+)
+
+// FieldError is returned by Pack and Unpack for a field that cannot be
+// encoded or decoded.
+type FieldError struct {
+	Field int
+	Err   error
+}
+
+func (e *FieldError) Error() string { return fmt.Sprintf("DE%d: %v", e.Field, e.Err) }
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// ValidateMTI checks that mti is four digits with an ISO version (0-2, or
+// 9 for private use), class (1-8), function (0-8) and origin (0-5).
+func ValidateMTI(mti string) error {
+	if len(mti) != 4 {
+		return fmt.Errorf("invalid MTI: %q", mti)
+	}
+	for i := 0; i < 4; i++ {
+		if !isDigit(mti[i]) {
+			return fmt.Errorf("invalid MTI: %q", mti)
+		}
+	}
+	switch {
+	case mti[0] > '2' && mti[0] != '9':
+		return fmt.Errorf("invalid MTI %s: unknown version %c", mti, mti[0])
+	case mti[1] < '1' || mti[1] > '8':
+		return fmt.Errorf("invalid MTI %s: unknown class %c", mti, mti[1])
+	case mti[2] > '8':
+		return fmt.Errorf("invalid MTI %s: unknown function %c", mti, mti[2])
+	case mti[3] > '5':
+		return fmt.Errorf("invalid MTI %s: unknown origin %c", mti, mti[3])
+	}
+	return nil
+}
+
+// validateField checks v against the content class and Luhn setting of fs.
+func validateField(fs FieldSpec, v string) error {
+	if i := badChar(fs.Class, v); i >= 0 {
+		return fmt.Errorf("%w: %q at position %d not allowed in %s", ErrContent, v[i], i+1, fs.Class)
+	}
+	if fs.Luhn && !Luhn(v) {
+		return ErrLuhn
+	}
+	return nil
+}
+
+// badChar returns the index of the first character not allowed in class
+// c, or -1.
+func badChar(c ContentClass, v string) int {
+	for i := 0; i < len(v); i++ {
+		ch := v[i]
+		var ok bool
+		switch c {
+		case ClassN:
+			ok = isDigit(ch)
+		case ClassA:
+			ok = isAlpha(ch) || ch == ' '
+		case ClassAN:
+			ok = isAlpha(ch) || isDigit(ch) || ch == ' '
+		case ClassANS:
+			ok = ch >= 0x20 && ch <= 0x7E
+		case ClassZ:
+			ok = ch >= '0' && ch <= '?' || ch == 'D'
+		case ClassXN:
+			ok = i == 0 && (ch == 'C' || ch == 'D') || i > 0 && isDigit(ch)
+		case ClassH:
+			ok = isHex(ch)
+		default:
+			ok = true
+		}
+		if !ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// Luhn reports whether the digit string pan has a valid mod-10 check digit.
+func Luhn(pan string) bool {
+	if len(pan) < 2 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(pan); i++ {
+		d := pan[len(pan)-1-i]
+		if !isDigit(d) {
+			return false
+		}
+		n := int(d - '0')
+		if i%2 == 1 {
+			if n *= 2; n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return sum%10 == 0
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isHex(c byte) bool { return isDigit(c) || c >= 'A' && c <= 'F' || c >= 'a' && c <= 'f' }
+
+func isAlpha(c byte) bool { return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' }
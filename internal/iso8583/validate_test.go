@@ -0,0 +1,132 @@
+package iso8583
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPackRejectsBadContent(t *testing.T) {
+	m := New("0200")
+	m.Set(11, "ABCDEF")
+	_, err := m.Pack(DefaultSpec)
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != 11 || !errors.Is(err, ErrContent) {
+		t.Fatalf("Pack err = %v, want content error on DE11", err)
+	}
+	if !strings.Contains(err.Error(), "DE11") {
+		t.Fatalf("error %q does not name the field", err)
+	}
+}
+
+func TestUnpackRejectsBadContent(t *testing.T) {
+	m := New("0200")
+	m.Set(4, "000000001000")
+	p, err := m.Pack(DefaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(p[len(p)-3:], "1X0")
+	_, err = Unpack(DefaultSpec, p)
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != 4 || !errors.Is(err, ErrContent) {
+		t.Fatalf("Unpack err = %v, want content error on DE4", err)
+	}
+}
+
+func TestUnpackLenientReportsBadContent(t *testing.T) {
+	m := New("0200")
+	m.Set(4, "000000001000")
+	m.Set(11, "123456")
+	p, err := m.Pack(DefaultSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(p[len(p)-6:], "12X4")
+	got, invalid, err := UnpackLenient(DefaultSpec, p)
+	if err != nil {
+		t.Fatalf("UnpackLenient: %v", err)
+	}
+	if v, _ := got.Get(11); v != "12X456" {
+		t.Fatalf("DE11 = %q", v)
+	}
+	if len(invalid) != 1 || invalid[0].Field != 11 || !errors.Is(invalid[0], ErrContent) {
+		t.Fatalf("invalid = %v, want content error on DE11", invalid)
+	}
+	if _, _, err := UnpackLenient(DefaultSpec, append(p, 0)); err == nil {
+		t.Fatal("UnpackLenient accepted trailing bytes")
+	}
+}
+
+func TestContentClasses(t *testing.T) {
+	for _, tc := range []struct {
+		class ContentClass
+		ok    []string
+		bad   []string
+	}{
+		{ClassN, []string{"0123456789", ""}, []string{"12 4", "1A"}},
+		{ClassA, []string{"ABC xyz"}, []string{"AB1"}},
+		{ClassAN, []string{"AB 12"}, []string{"AB-1"}},
+		{ClassANS, []string{"A1 -/*~"}, []string{"A\x00", "\xE9"}},
+		{ClassZ, []string{"4111111111111111=2512", "4111D2512?"}, []string{"4111^2512"}},
+		{ClassXN, []string{"C00000100", "D1"}, []string{"00000100", "CC1"}},
+		{ClassB, []string{"\x00\xFF"}, nil},
+		{ClassH, []string{"09AFaf", ""}, []string{"\x00", "0G"}},
+	} {
+		fs := FieldSpec{Class: tc.class}
+		for _, v := range tc.ok {
+			if err := validateField(fs, v); err != nil {
+				t.Errorf("%s %q: %v", tc.class, v, err)
+			}
+		}
+		for _, v := range tc.bad {
+			if err := validateField(fs, v); !errors.Is(err, ErrContent) {
+				t.Errorf("%s %q: err = %v, want ErrContent", tc.class, v, err)
+			}
+		}
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	for _, pan := range []string{"4111111111111111", "4761739001010119", "5555555555554444", "79927398713"} {
+		if !Luhn(pan) {
+			t.Errorf("Luhn(%s) = false", pan)
+		}
+	}
+	for _, pan := range []string{"4111111111111112", "79927398710", "4111a11111111111", "0"} {
+		if Luhn(pan) {
+			t.Errorf("Luhn(%s) = true", pan)
+		}
+	}
+
+	spec := &Spec{Fields: map[int]FieldSpec{2: {Num: 2, Name: "PAN", Codec: FmtLLVAR, Class: ClassN, Luhn: true}}, Charset: CharsetASCII}
+	m := New("0200")
+	m.Set(2, "4111111111111112")
+	if _, err := m.Pack(spec); !errors.Is(err, ErrLuhn) {
+		t.Fatalf("Pack err = %v, want ErrLuhn", err)
+	}
+	m.Set(2, "4111111111111111")
+	if _, err := m.Pack(spec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateMTI(t *testing.T) {
+	for _, mti := range []string{"0100", "0210", "0420", "0800", "1200", "9805", "2110"} {
+		if err := ValidateMTI(mti); err != nil {
+			t.Errorf("ValidateMTI(%s): %v", mti, err)
+		}
+	}
+	for _, mti := range []string{"", "010", "01000", "A100", "3100", "0000", "0900", "0190", "0106"} {
+		if err := ValidateMTI(mti); err == nil {
+			t.Errorf("ValidateMTI(%q): expected error", mti)
+		}
+	}
+	m := New("0000")
+	if _, err := m.Pack(DefaultSpec); err == nil {
+		t.Fatal("Pack accepted MTI 0000")
+	}
+	if _, err := Unpack(DefaultSpec, []byte("0900\x00\x00\x00\x00\x00\x00\x00\x00")); err == nil {
+		t.Fatal("Unpack accepted MTI 0900")
+	}
+}
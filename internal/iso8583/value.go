@@ -0,0 +1,107 @@
+package iso8583
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// valueKind tells how a field's string holds its data.
+type valueKind int
+
+const (
+	valueText   valueKind = iota // characters
+	valueBinary                  // raw bytes: binary codecs and ClassB
+	valueHex                     // binary data as hex digits: ClassH in a character codec
+)
+
+// Value is a field value that knows whether it holds text or binary data,
+// as decided by the field's spec.
+type Value struct {
+	raw  string
+	kind valueKind
+}
+
+// Raw returns the value as stored in Message.Fields.
+func (v Value) Raw() string { return v.raw }
+
+// Binary reports whether the value is binary data.
+func (v Value) Binary() bool { return v.kind != valueText }
+
+// Bytes returns the data: raw bytes, decoded hex digits, or the text's
+// bytes. Hex digits that do not decode are an error.
+func (v Value) Bytes() ([]byte, error) {
+	if v.kind == valueHex {
+		b, err := hex.DecodeString(v.raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrContent, err)
+		}
+		return b, nil
+	}
+	return []byte(v.raw), nil
+}
+
+// String returns the display form: upper-case hex for binary data, the
+// text otherwise.
+func (v Value) String() string {
+	switch v.kind {
+	case valueBinary:
+		return strings.ToUpper(hex.EncodeToString([]byte(v.raw)))
+	case valueHex:
+		return strings.ToUpper(v.raw)
+	}
+	return v.raw
+}
+
+// kindOf returns how field f of the spec stores its data.
+func (s *Spec) kindOf(f int) valueKind {
+	fs := s.Fields[f]
+	switch {
+	case rawData(fs.Codec) || fs.Class == ClassB:
+		return valueBinary
+	case fs.Class == ClassH:
+		return valueHex
+	}
+	return valueText
+}
+
+// Value returns field f interpreted with spec, or DefaultSpec if spec is
+// nil. Pass the spec the message is packed or was unpacked with.
+func (m *Message) Value(spec *Spec, f int) (Value, bool) {
+	if spec == nil {
+		spec = DefaultSpec
+	}
+	v, ok := m.Get(f)
+	if !ok {
+		return Value{}, false
+	}
+	return Value{raw: v, kind: spec.kindOf(f)}, true
+}
+
+// SetBytes sets field f to b in the form spec (DefaultSpec if nil)
+// expects: as upper-case hex for ClassH fields with a character codec
+// (e.g. a PIN block sent as 16 hex digits), otherwise as is.
+func (m *Message) SetBytes(spec *Spec, f int, b []byte) {
+	if spec == nil {
+		spec = DefaultSpec
+	}
+	if spec.kindOf(f) == valueHex {
+		m.Set(f, strings.ToUpper(hex.EncodeToString(b)))
+		return
+	}
+	m.Set(f, string(b))
+}
+
+// GetBytes returns the data of field f, the inverse of SetBytes. A
+// ClassH field that is not valid hex returns a *FieldError.
+func (m *Message) GetBytes(spec *Spec, f int) ([]byte, bool, error) {
+	v, ok := m.Value(spec, f)
+	if !ok {
+		return nil, false, nil
+	}
+	b, err := v.Bytes()
+	if err != nil {
+		return nil, true, &FieldError{Field: f, Err: err}
+	}
+	return b, true, nil
+}
@@ -0,0 +1,112 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"go-payment-gateway/internal/iso8583/emv"
+)
+
+func TestBytesFollowSpec(t *testing.T) {
+	pin := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF}
+	bcd, err := LoadSpec("../../specs/bcd-switch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		spec *Spec
+		raw  string
+	}{
+		{DefaultSpec, "0123456789ABCDEF"},         // fixed-ans 16, class h: hex digits
+		{bcd, "\x01\x23\x45\x67\x89\xab\xcd\xef"}, // binary 8: raw bytes
+	} {
+		m := New("0200") // no SetSpec: the spec passed in decides
+		m.SetBytes(tc.spec, 52, pin)
+		if v, _ := m.Get(52); v != tc.raw {
+			t.Fatalf("%s: DE52 = %q, want %q", tc.spec.Name, v, tc.raw)
+		}
+		p, err := m.Pack(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec.Name, err)
+		}
+		got, err := Unpack(tc.spec, p)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.spec.Name, err)
+		}
+		b, ok, err := got.GetBytes(tc.spec, 52)
+		if !ok || err != nil || !bytes.Equal(b, pin) {
+			t.Fatalf("%s: GetBytes = %X, %v, %v", tc.spec.Name, b, ok, err)
+		}
+		v, _ := got.Value(tc.spec, 52)
+		if !v.Binary() || v.String() != "0123456789ABCDEF" || v.Raw() != tc.raw {
+			t.Fatalf("%s: Value = %q binary=%v display=%s", tc.spec.Name, v.Raw(), v.Binary(), v)
+		}
+	}
+}
+
+func TestTextValue(t *testing.T) {
+	m := New("0200")
+	m.Set(41, "TERM0001")
+	v, ok := m.Value(nil, 41)
+	if b, err := v.Bytes(); !ok || v.Binary() || v.String() != "TERM0001" || string(b) != "TERM0001" || err != nil {
+		t.Fatalf("Value = %+v", v)
+	}
+	if _, ok := m.Value(nil, 42); ok {
+		t.Fatal("Value of absent field")
+	}
+}
+
+func TestGetBytesRejectsBadHex(t *testing.T) {
+	m := New("0200")
+	m.Set(52, "0123456789ABCDEG")
+	var fe *FieldError
+	if _, ok, err := m.GetBytes(nil, 52); !ok || !errors.As(err, &fe) || fe.Field != 52 || !errors.Is(err, ErrContent) {
+		t.Fatalf("GetBytes of bad hex: %v, %v", ok, err)
+	}
+}
+
+func TestRawDE55KeepsWorking(t *testing.T) {
+	raw := "\x9f\x27\x01\x80"
+	m := New("0100")
+	m.Set(55, raw)
+	p, err := m.Pack(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(p, []byte("004"+raw)) {
+		t.Fatalf("DE55 not sent as raw bytes: % X", p)
+	}
+	got, err := Unpack(nil, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := got.Get(55); v != raw {
+		t.Fatalf("DE55 = %q", v)
+	}
+}
+
+func TestEMVOnBinarySpec(t *testing.T) {
+	bcd, err := LoadSpec("../../specs/bcd-switch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New("0100")
+	m.SetSpec(bcd)
+	m.SetEMV(map[emv.Tag][]byte{emv.TagCryptogramInfo: {0x80}})
+	if v, _ := m.Get(55); v != "\x9f\x27\x01\x80" {
+		t.Fatalf("DE55 = %q, want raw TLV", v)
+	}
+}
+
+func TestRedactedShowsBinaryAsHex(t *testing.T) {
+	spec := &Spec{Name: "bin", Charset: CharsetASCII, Fields: map[int]FieldSpec{
+		64: {Num: 64, Name: "MAC", Codec: FmtBinary, Len: 8, Class: ClassB},
+	}}
+	m := New("0200")
+	m.SetSpec(spec)
+	m.SetBytes(spec, 64, []byte{0xDE, 0xAD, 0xBE, 0xEF, 0, 0, 0, 1})
+	if got := m.String(); got != "0200 64=DEADBEEF00000001" {
+		t.Fatalf("String = %q", got)
+	}
+}
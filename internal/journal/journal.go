@@ -0,0 +1,268 @@
+// Package journal records every message the gateway exchanges in an
+// append-only JSON lines file, so that any transaction can be
+// reconstructed later, e.g. for a dispute.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+// Directions of an Entry.
+const (
+	Outbound = "out"
+	Inbound  = "in"
+)
+
+const (
+	current     = "journal.jsonl"
+	rotatedFmt  = "journal-20060102T150405.000000000.jsonl"
+	defaultSize = 64 << 20
+)
+
+// Entry is one journalled message.
+type Entry struct {
+	Time    time.Time      `json:"time"`
+	Dir     string         `json:"dir"`
+	Link    string         `json:"link"`
+	Key     string         `json:"key"` // correlation key
+	Outcome string         `json:"outcome"`
+	MTI     string         `json:"mti"`
+	Fields  map[int]string `json:"fields"`
+}
+
+// NewEntry builds an entry for m stamped with the current time. Cardholder
+// data is masked as in Message.Redacted.
+func NewEntry(dir, link, key, outcome string, m *iso8583.Message) Entry {
+	return Entry{Time: time.Now().UTC(), Dir: dir, Link: link, Key: key, Outcome: outcome, MTI: m.MTI, Fields: m.Redacted()}
+}
+
+// Config configures a Journal.
+type Config struct {
+	Dir      string // directory holding the journal files
+	MaxBytes int64  // rotate once the current file exceeds this size
+}
+
+// Journal appends entries to Dir/journal.jsonl, fsyncing each one, and
+// rotates the file to journal-<time>.jsonl when it grows past MaxBytes.
+type Journal struct {
+	cfg Config
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Open opens or creates the journal in cfg.Dir.
+func Open(cfg Config) (*Journal, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultSize
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	j := &Journal{cfg: cfg}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	f, err := os.OpenFile(filepath.Join(j.cfg.Dir, current), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.f, j.size = f, fi.Size()
+	return j.terminateLocked()
+}
+
+// terminateLocked ends a line torn by a crash so the next entry starts on
+// its own line.
+func (j *Journal) terminateLocked() error {
+	if j.size == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	r, err := os.Open(j.f.Name())
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := r.ReadAt(last, j.size-1); err != nil || last[0] == '\n' {
+		return err
+	}
+	n, err := j.f.Write([]byte{'\n'})
+	j.size += int64(n)
+	return err
+}
+
+// Append writes e and syncs it to disk before returning.
+func (j *Journal) Append(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return os.ErrClosed
+	}
+	if j.size > 0 && j.size+int64(len(b)) > j.cfg.MaxBytes {
+		if err := j.rotateLocked(); err != nil {
+			return fmt.Errorf("rotate journal: %w", err)
+		}
+	}
+	n, err := j.f.Write(b)
+	j.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// rotateLocked renames the current file aside and starts a new one. If
+// that fails the current file is reopened, so only the entry that
+// triggered the rotation is lost.
+func (j *Journal) rotateLocked() error {
+	err := j.f.Close()
+	j.f = nil
+	if err == nil {
+		name := time.Now().UTC().Format(rotatedFmt)
+		err = os.Rename(filepath.Join(j.cfg.Dir, current), filepath.Join(j.cfg.Dir, name))
+	}
+	if oerr := j.open(); oerr != nil {
+		return errors.Join(err, oerr)
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(j.cfg.Dir)
+}
+
+// syncDir makes renames and new files in dir survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Close closes the current file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Query selects entries. Empty fields match everything.
+type Query struct {
+	STAN  string    // DE11
+	RRN   string    // DE37
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+	Limit int       // 0 is unlimited
+}
+
+func (q Query) match(e *Entry) bool {
+	if q.STAN != "" && e.Fields[11] != q.STAN {
+		return false
+	}
+	if q.RRN != "" && e.Fields[37] != q.RRN {
+		return false
+	}
+	if !q.From.IsZero() && e.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !e.Time.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// Find returns matching entries, oldest first, from the current and all
+// rotated files.
+func (j *Journal) Find(q Query) ([]Entry, error) {
+	files, err := j.files()
+	if err != nil {
+		return nil, err
+	}
+	var out []Entry
+	for _, name := range files {
+		// A rotated file holds nothing newer than its rotation time.
+		if t, err := time.Parse(rotatedFmt, name); err == nil && !q.From.IsZero() && t.Before(q.From) {
+			continue
+		}
+		out, err = scan(filepath.Join(j.cfg.Dir, name), q, out)
+		if err != nil {
+			return nil, err
+		}
+		if q.Limit > 0 && len(out) >= q.Limit {
+			return out[:q.Limit], nil
+		}
+	}
+	return out, nil
+}
+
+// files lists journal files oldest first; the current file sorts last.
+func (j *Journal) files() ([]string, error) {
+	des, err := os.ReadDir(j.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, de := range des {
+		if n := de.Name(); strings.HasPrefix(n, "journal") && strings.HasSuffix(n, ".jsonl") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func scan(path string, q Query, out []Entry) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil // rotated away meanwhile
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue // torn last line after a crash
+		}
+		if q.match(&e) {
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
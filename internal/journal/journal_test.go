@@ -0,0 +1,151 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+func msg(mti, stan, rrn string) *iso8583.Message {
+	m := iso8583.New(mti)
+	m.Set(11, stan)
+	m.Set(37, rrn)
+	return m
+}
+
+func TestAppendRotateAndFind(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(Config{Dir: dir, MaxBytes: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().UTC()
+	for i, stan := range []string{"000001", "000002", "000003", "000004"} {
+		rrn := "62890700000" + stan[5:]
+		if err := j.Append(NewEntry(Outbound, "a", "k", "sent", msg("0200", stan, rrn))); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+		if err := j.Append(NewEntry(Inbound, "a", "k", "matched", msg("0210", stan, rrn))); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+
+	files, _ := j.files()
+	if len(files) < 2 {
+		t.Fatalf("expected rotation, files %v", files)
+	}
+
+	got, err := j.Find(Query{STAN: "000003"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].MTI != "0200" || got[1].MTI != "0210" || got[1].Outcome != "matched" {
+		t.Fatalf("by STAN: %+v", got)
+	}
+	if got, _ := j.Find(Query{RRN: "628907000004"}); len(got) != 2 {
+		t.Fatalf("by RRN: %d entries", len(got))
+	}
+	if got, _ := j.Find(Query{From: start.Add(-time.Minute), Limit: 3}); len(got) != 3 {
+		t.Fatalf("limit: %d entries", len(got))
+	}
+	if got, _ := j.Find(Query{From: time.Now().Add(time.Minute)}); len(got) != 0 {
+		t.Fatalf("future range: %d entries", len(got))
+	}
+
+	// Entries survive reopening.
+	j.Close()
+	j, err = Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if got, _ := j.Find(Query{}); len(got) != 8 {
+		t.Fatalf("after reopen: %d entries", len(got))
+	}
+}
+
+func TestFindSkipsTornLine(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	j.Append(NewEntry(Outbound, "a", "k", "sent", msg("0200", "000001", "")))
+	f, _ := os.OpenFile(dir+"/journal.jsonl", os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"time":"2026-`)
+	f.Close()
+	if got, err := j.Find(Query{}); err != nil || len(got) != 1 {
+		t.Fatalf("got %d entries, %v", len(got), err)
+	}
+
+	// Reopening ends the torn line so new entries stay readable.
+	j.Close()
+	j, err = Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Append(NewEntry(Outbound, "a", "k", "sent", msg("0200", "000002", "")))
+	if got, err := j.Find(Query{}); err != nil || len(got) != 2 {
+		t.Fatalf("after reopen got %d entries, %v", len(got), err)
+	}
+}
+
+func TestKeyExchangeKeyNotJournaled(t *testing.T) {
+	const key = "A1B2C3D4E5F60718293A4B5C6D7E8F90"
+	dir := t.TempDir()
+	j, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	m := msg("0810", "000042", "")
+	m.Set(39, "00")
+	m.Set(48, key)
+	m.Set(70, "161")
+	if err := j.Append(NewEntry(Inbound, "a", "k", "matched", m)); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := j.files()
+	for _, name := range files {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), key) {
+			t.Fatalf("working key journaled: %s", b)
+		}
+	}
+	if got, _ := j.Find(Query{STAN: "000042"}); len(got) != 1 || got[0].Fields[48] != "[redacted]" {
+		t.Fatalf("entries %+v", got)
+	}
+}
+
+func TestFailedRotationKeepsJournaling(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(Config{Dir: dir, MaxBytes: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if err := j.Append(NewEntry(Outbound, "a", "k", "sent", msg("0200", "000001", ""))); err != nil {
+		t.Fatal(err)
+	}
+	// With the current file gone, the rename behind the next rotation fails.
+	if err := os.Remove(filepath.Join(dir, current)); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(NewEntry(Outbound, "a", "k", "sent", msg("0200", "000002", ""))); err == nil {
+		t.Fatal("expected rotation error")
+	}
+	if err := j.Append(NewEntry(Outbound, "a", "k", "sent", msg("0200", "000003", ""))); err != nil {
+		t.Fatalf("Append after failed rotation: %v", err)
+	}
+	if got, _ := j.Find(Query{STAN: "000003"}); len(got) != 1 {
+		t.Fatalf("entry after failed rotation not found: %+v", got)
+	}
+}
@@ -0,0 +1,107 @@
+package mac
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// FIPS 113 example: DES CBC-MAC of "7654321 Now is the time for ".
+func TestX99Vector(t *testing.T) {
+	got, err := Compute(X99, unhex(t, "0123456789ABCDEF"), []byte("7654321 Now is the time for "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:4], unhex(t, "F1D30F68")) {
+		t.Fatalf("MAC = %X, want F1D30F68...", got)
+	}
+}
+
+// X9.19 is a DES CBC-MAC whose last block is encrypted with two-key 3DES.
+func TestX919MatchesTripleDESFinalBlock(t *testing.T) {
+	key := unhex(t, "0123456789ABCDEFFEDCBA9876543210")
+	data := []byte("0200 4111111111111111 000000001000")
+
+	padded := pad(X919, data)
+	k1, _ := des.NewCipher(key[:8])
+	chain := make([]byte, len(padded)-Size)
+	iv := make([]byte, Size)
+	if len(chain) > 0 {
+		cipher.NewCBCEncrypter(k1, iv).CryptBlocks(chain, padded[:len(chain)])
+		iv = chain[len(chain)-Size:]
+	}
+	tdes, _ := des.NewTripleDESCipher(append(append([]byte{}, key...), key[:8]...))
+	want := make([]byte, Size)
+	cipher.NewCBCEncrypter(tdes, iv).CryptBlocks(want, padded[len(chain):])
+
+	got, err := Compute(X919, key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("X9.19 = %X, want %X", got, want)
+	}
+
+	// With K1 == K2 the 3DES step cancels out to X9.9.
+	same := append(key[:8:8], key[:8]...)
+	a, _ := Compute(X919, same, data)
+	b, _ := Compute(X99, key[:8], data)
+	if !bytes.Equal(a, b) {
+		t.Fatalf("X9.19 with K1=K2 = %X, X9.9 = %X", a, b)
+	}
+}
+
+func TestISO9797Alg3Padding(t *testing.T) {
+	key := unhex(t, "0123456789ABCDEFFEDCBA9876543210")
+	data := []byte("12345678") // one full block
+	if got := pad(ISO9797Alg3, data); len(got) != 16 || got[8] != 0x80 {
+		t.Fatalf("pad = %X", got)
+	}
+	if got := pad(X919, data); len(got) != 8 {
+		t.Fatalf("pad = %X", got)
+	}
+	a, _ := Compute(ISO9797Alg3, key, data)
+	b, _ := Compute(X919, key, data)
+	if bytes.Equal(a, b) {
+		t.Fatal("padding methods gave the same MAC")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := unhex(t, "0123456789ABCDEFFEDCBA9876543210")
+	data := []byte("message")
+	m, err := Compute(X919, key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		mac  []byte
+		want bool
+	}{
+		{m, true},
+		{m[:4], true},
+		{append([]byte{m[0] ^ 1}, m[1:]...), false},
+		{nil, false},
+	} {
+		if ok, err := Verify(X919, key, data, tc.mac); err != nil || ok != tc.want {
+			t.Errorf("Verify(%X) = %v, %v", tc.mac, ok, err)
+		}
+	}
+	if _, err := Compute(X919, key[:8], data); err == nil {
+		t.Fatal("expected key length error")
+	}
+	if _, err := ParseAlgorithm("cmac"); err == nil {
+		t.Fatal("expected unknown algorithm")
+	}
+}
@@ -0,0 +1,226 @@
+package netmgmt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+// EchoLink is the upstream connection an EchoMonitor probes.
+type EchoLink interface {
+	SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error)
+	Up() bool
+	// SetDegraded takes a link out of rotation while its echoes fail.
+	SetDegraded(degraded bool)
+	// Reconnect drops the connection so that it is dialled again.
+	Reconnect()
+}
+
+// EchoAction is what an EchoMonitor does after too many missed echoes.
+type EchoAction int
+
+const (
+	EchoDegrade   EchoAction = iota // hold the link until an echo succeeds
+	EchoReconnect                   // drop the connection and dial again
+)
+
+// ParseEchoAction maps "degrade" or "reconnect" to an EchoAction.
+func ParseEchoAction(s string) (EchoAction, error) {
+	switch s {
+	case "degrade":
+		return EchoDegrade, nil
+	case "reconnect":
+		return EchoReconnect, nil
+	}
+	return 0, fmt.Errorf("unknown echo action %q", s)
+}
+
+// EchoConfig configures an EchoMonitor.
+type EchoConfig struct {
+	Name      string // link name for logs
+	Interval  time.Duration
+	Timeout   time.Duration // how long to wait for the 0810
+	MaxMissed int           // consecutive misses before Action, 0 never acts
+	Action    EchoAction
+	NextSTAN  func() int
+	// Ready, if set, must also report true for Run to probe, e.g. once the
+	// link is signed on.
+	Ready func() bool
+	// OnResult is called after every echo with the updated statistics.
+	OnResult func(stan int, rtt time.Duration, err error, st EchoStats)
+}
+
+// EchoStats is a snapshot of an EchoMonitor for the admin API.
+type EchoStats struct {
+	Outstanding       int               `json:"outstanding"`
+	ConsecutiveMissed int               `json:"consecutive_missed"`
+	Missed            uint64            `json:"missed"`
+	Degraded          bool              `json:"degraded"`
+	RTT               HistogramSnapshot `json:"rtt"`
+}
+
+// EchoMonitor sends periodic 0800/301 echo tests on one link, measures
+// their round trip and acts on consecutive misses.
+type EchoMonitor struct {
+	cfg  EchoConfig
+	link EchoLink
+
+	mu          sync.Mutex
+	outstanding map[int]time.Time // STAN -> sent
+	consecutive int
+	missed      uint64
+	degraded    bool
+	rtt         *Histogram
+}
+
+// NewEchoMonitor creates a monitor for link.
+func NewEchoMonitor(cfg EchoConfig, link EchoLink) *EchoMonitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	return &EchoMonitor{cfg: cfg, link: link, outstanding: make(map[int]time.Time), rtt: NewHistogram(DefaultRTTBuckets)}
+}
+
+// Run probes the link every Interval while it is up and Ready, until ctx
+// is done.
+func (e *EchoMonitor) Run(ctx context.Context) {
+	t := time.NewTicker(e.cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if e.link.Up() && (e.cfg.Ready == nil || e.cfg.Ready()) {
+				go e.Probe(ctx)
+			}
+		}
+	}
+}
+
+// Probe sends one echo test and records the outcome.
+func (e *EchoMonitor) Probe(ctx context.Context) error {
+	stan := e.cfg.NextSTAN()
+	sent := time.Now()
+	e.mu.Lock()
+	e.outstanding[stan] = sent
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	resp, err := e.link.SendAndWait(ctx, iso8583.NewEchoRequest(stan))
+	rtt := time.Since(sent)
+	if err == nil && !iso8583.IsEchoResponse(resp) {
+		err = fmt.Errorf("unexpected echo response MTI %s", resp.MTI)
+	}
+
+	e.mu.Lock()
+	delete(e.outstanding, stan)
+	var act, recovered bool
+	if err == nil {
+		e.rtt.Observe(rtt.Seconds())
+		recovered = e.degraded
+		e.consecutive = 0
+		e.degraded = false
+	} else {
+		e.missed++
+		e.consecutive++
+		if e.cfg.MaxMissed > 0 && e.consecutive >= e.cfg.MaxMissed {
+			act = true
+			if e.cfg.Action == EchoDegrade {
+				e.degraded = true
+			} else {
+				e.consecutive = 0
+			}
+		}
+	}
+	st := e.statsLocked()
+	e.mu.Unlock()
+
+	switch {
+	case recovered:
+		log.Printf("%s: echo recovered, link back in rotation", e.cfg.Name)
+		e.link.SetDegraded(false)
+	case act && e.cfg.Action == EchoDegrade:
+		log.Printf("%s: %d consecutive echoes missed, link degraded", e.cfg.Name, st.ConsecutiveMissed)
+		e.link.SetDegraded(true)
+	case act:
+		log.Printf("%s: %d consecutive echoes missed, reconnecting", e.cfg.Name, e.cfg.MaxMissed)
+		e.link.Reconnect()
+	}
+	if e.cfg.OnResult != nil {
+		e.cfg.OnResult(stan, rtt, err, st)
+	}
+	return err
+}
+
+// Stats returns the current statistics.
+func (e *EchoMonitor) Stats() EchoStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.statsLocked()
+}
+
+func (e *EchoMonitor) statsLocked() EchoStats {
+	return EchoStats{
+		Outstanding:       len(e.outstanding),
+		ConsecutiveMissed: e.consecutive,
+		Missed:            e.missed,
+		Degraded:          e.degraded,
+		RTT:               e.rtt.Snapshot(),
+	}
+}
+
+// DefaultRTTBuckets are echo round-trip histogram bounds in seconds.
+var DefaultRTTBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Histogram counts observations into fixed buckets, Prometheus style.
+// It is not safe for concurrent use.
+type Histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; last is +Inf
+	sum    float64
+}
+
+// NewHistogram creates a histogram with ascending upper bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += v
+}
+
+// HistogramSnapshot holds cumulative bucket counts; Counts[i] is the number
+// of observations <= Bounds[i] and Count includes the +Inf bucket.
+type HistogramSnapshot struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// Snapshot returns cumulative counts.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{Bounds: h.bounds, Counts: make([]uint64, len(h.bounds)), Sum: h.sum}
+	for i, c := range h.counts {
+		s.Count += c
+		if i < len(s.Counts) {
+			s.Counts[i] = s.Count
+		}
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package netmgmt
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/inbound"
+	"go-payment-gateway/internal/iso8583"
+)
+
+type echoLink struct {
+	answer      bool
+	degraded    bool
+	reconnected int
+}
+
+func (l *echoLink) SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+	if !l.answer {
+		return nil, errors.New("response timeout")
+	}
+	return inbound.Approve(m), nil
+}
+
+func (l *echoLink) Up() bool                  { return true }
+func (l *echoLink) SetDegraded(degraded bool) { l.degraded = degraded }
+func (l *echoLink) Reconnect()                { l.reconnected++ }
+
+func TestEchoMonitorDegradesAndRecovers(t *testing.T) {
+	link := &echoLink{}
+	e := NewEchoMonitor(EchoConfig{Timeout: time.Second, MaxMissed: 2, NextSTAN: func() int { return 7 }}, link)
+	ctx := context.Background()
+
+	e.Probe(ctx)
+	if link.degraded {
+		t.Fatalf("degraded after one miss")
+	}
+	e.Probe(ctx)
+	if !link.degraded || !e.Stats().Degraded || e.Stats().Missed != 2 {
+		t.Fatalf("not degraded after two misses: %+v", e.Stats())
+	}
+
+	link.answer = true
+	if err := e.Probe(ctx); err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	st := e.Stats()
+	if link.degraded || st.ConsecutiveMissed != 0 || st.RTT.Count != 1 || st.Outstanding != 0 {
+		t.Fatalf("not recovered: %+v", st)
+	}
+}
+
+func TestEchoMonitorReconnects(t *testing.T) {
+	link := &echoLink{}
+	e := NewEchoMonitor(EchoConfig{Timeout: time.Second, MaxMissed: 2, Action: EchoReconnect, NextSTAN: func() int { return 7 }}, link)
+	for i := 0; i < 4; i++ {
+		e.Probe(context.Background())
+	}
+	if link.reconnected != 2 || link.degraded {
+		t.Fatalf("reconnected %d times, degraded %v", link.reconnected, link.degraded)
+	}
+}
+
+func TestHistogramSnapshot(t *testing.T) {
+	h := NewHistogram([]float64{0.01, 0.1})
+	for _, v := range []float64{0.005, 0.05, 0.05, 3} {
+		h.Observe(v)
+	}
+	s := h.Snapshot()
+	if s.Counts[0] != 1 || s.Counts[1] != 3 || s.Count != 4 || s.Sum != 3.105 {
+		t.Fatalf("snapshot %+v", s)
+	}
+}
+
+func TestEchoMonitorWaitsUntilReady(t *testing.T) {
+	link := &echoLink{answer: true}
+	var ready atomic.Bool
+	probed := make(chan struct{}, 10)
+	e := NewEchoMonitor(EchoConfig{
+		Interval: 5 * time.Millisecond,
+		NextSTAN: func() int { return 7 },
+		Ready:    ready.Load,
+		OnResult: func(int, time.Duration, error, EchoStats) { probed <- struct{}{} },
+	}, link)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	select {
+	case <-probed:
+		t.Fatal("probed before the link was ready")
+	case <-time.After(50 * time.Millisecond):
+	}
+	ready.Store(true)
+	select {
+	case <-probed:
+	case <-time.After(time.Second):
+		t.Fatal("no probe once ready")
+	}
+}
@@ -0,0 +1,271 @@
+// Package netmgmt runs the 0800 network management lifecycle of one
+// upstream link: sign-on after connect, sign-off on shutdown, cutover, key
+// exchange and echo tests.
+package netmgmt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go-payment-gateway/internal/inbound"
+	"go-payment-gateway/internal/iso8583"
+)
+
+// DE70 network management information codes.
+const (
+	CodeSignOn     = "001"
+	CodeSignOff    = "002"
+	CodeKeyChange  = "101" // host delivers a new working key
+	CodeKeyRequest = "161" // gateway asks the host for a new working key
+	CodeCutover    = "201"
+	CodeEchoTest   = "301"
+)
+
+const (
+	keyField        = 48 // key material is passed through from DE48 untouched
+	approvedRC      = "00"
+	defaultRetry    = 10 * time.Second
+	defaultExchange = 30 * time.Second
+)
+
+// Link is the upstream connection a Manager drives.
+type Link interface {
+	SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error)
+	// SetHeld keeps the link out of rotation for financial traffic.
+	SetHeld(held bool)
+}
+
+// State is the network management state of a link.
+type State int
+
+const (
+	StateDown      State = iota // not connected
+	StateSigningOn              // connected, waiting for a 0810 to our 001
+	StateSignedOn               // open for financial traffic
+	StateSignedOff              // signed off by us or the host
+)
+
+var stateNames = [...]string{"down", "signing-on", "signed-on", "signed-off"}
+
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+func (s State) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Status is a snapshot of a Manager for the admin API.
+type Status struct {
+	State           State     `json:"state"`
+	SignedOnAt      time.Time `json:"signed_on_at"`
+	LastCutover     time.Time `json:"last_cutover"`
+	LastKeyExchange time.Time `json:"last_key_exchange"`
+	LastError       string    `json:"last_error,omitempty"`
+}
+
+// Config configures a Manager.
+type Config struct {
+	Name        string // link name for logs
+	NextSTAN    func() int
+	Retry       time.Duration // delay between failed sign-on attempts
+	Timeout     time.Duration // per 0800 exchange
+	KeyInterval time.Duration // period between 161 key requests, 0 disables
+	OnKey       func(key string)
+	OnChange    func(Status)
+}
+
+// Manager holds a link until it is signed on and answers host-initiated
+// network management requests on it.
+type Manager struct {
+	cfg  Config
+	link Link
+
+	mu     sync.Mutex
+	st     Status
+	cancel context.CancelFunc
+}
+
+// New creates a manager and holds link until the first sign-on succeeds.
+func New(cfg Config, link Link) *Manager {
+	if cfg.Retry <= 0 {
+		cfg.Retry = defaultRetry
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultExchange
+	}
+	link.SetHeld(true)
+	return &Manager{cfg: cfg, link: link}
+}
+
+// Status returns the current state.
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.st
+}
+
+// SignedOn reports whether the link is open for traffic.
+func (m *Manager) SignedOn() bool { return m.Status().State == StateSignedOn }
+
+// LinkUp starts signing on. Wire it to the Connector's onUp callback.
+func (m *Manager) LinkUp() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.cancel = cancel
+	m.mu.Unlock()
+	m.update(func(s *Status) { s.State = StateSigningOn })
+	go m.run(ctx)
+}
+
+// LinkDown holds the link and stops any sign-on in progress. Wire it to the
+// Connector's onDown callback.
+func (m *Manager) LinkDown(err error) {
+	m.link.SetHeld(true)
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.mu.Unlock()
+	m.update(func(s *Status) { s.State = StateDown })
+}
+
+// SignOff holds the link and sends a 002. Call it before closing the
+// connection on shutdown.
+func (m *Manager) SignOff(ctx context.Context) error {
+	m.link.SetHeld(true)
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	signedOn := m.st.State == StateSignedOn
+	m.mu.Unlock()
+	if !signedOn {
+		return nil
+	}
+	_, err := m.exchange(ctx, CodeSignOff)
+	m.update(func(s *Status) { s.State = StateSignedOff })
+	return err
+}
+
+// RequestKey asks the host for a new working key with a 161.
+func (m *Manager) RequestKey(ctx context.Context) error {
+	resp, err := m.exchange(ctx, CodeKeyRequest)
+	if err != nil {
+		m.update(func(s *Status) { s.LastError = err.Error() })
+		return err
+	}
+	m.installKey(resp)
+	return nil
+}
+
+// Register installs handlers for host-initiated sign-on, sign-off, key
+// change and cutover requests in r, replacing the stateless defaults.
+func (m *Manager) Register(r *inbound.Registry) {
+	r.Handle("0800", CodeSignOn, func(req *iso8583.Message) *iso8583.Message {
+		m.signedOn()
+		return inbound.Approve(req)
+	})
+	r.Handle("0800", CodeSignOff, func(req *iso8583.Message) *iso8583.Message {
+		m.link.SetHeld(true)
+		m.update(func(s *Status) { s.State = StateSignedOff })
+		return inbound.Approve(req)
+	})
+	r.Handle("0800", CodeKeyChange, func(req *iso8583.Message) *iso8583.Message {
+		m.installKey(req)
+		return inbound.Approve(req)
+	})
+	r.Handle("0800", CodeCutover, func(req *iso8583.Message) *iso8583.Message {
+		log.Printf("%s: cutover", m.cfg.Name)
+		m.update(func(s *Status) { s.LastCutover = time.Now() })
+		return inbound.Approve(req)
+	})
+}
+
+func (m *Manager) run(ctx context.Context) {
+	for {
+		_, err := m.exchange(ctx, CodeSignOn)
+		if ctx.Err() != nil {
+			return // link went down meanwhile
+		}
+		if err == nil {
+			m.signedOn()
+			break
+		}
+		log.Printf("%s: sign-on failed: %v", m.cfg.Name, err)
+		m.update(func(s *Status) { s.LastError = err.Error() })
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.cfg.Retry):
+		}
+	}
+	if m.cfg.KeyInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(m.cfg.KeyInterval)
+	defer t.Stop()
+	for {
+		if err := m.RequestKey(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("%s: key request failed: %v", m.cfg.Name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (m *Manager) signedOn() {
+	m.update(func(s *Status) {
+		s.State = StateSignedOn
+		s.SignedOnAt = time.Now()
+		s.LastError = ""
+	})
+	m.link.SetHeld(false)
+	log.Printf("%s: signed on", m.cfg.Name)
+}
+
+func (m *Manager) installKey(msg *iso8583.Message) {
+	if key, ok := msg.Get(keyField); ok && m.cfg.OnKey != nil {
+		m.cfg.OnKey(key)
+	}
+	m.update(func(s *Status) { s.LastKeyExchange = time.Now() })
+}
+
+// exchange sends an 0800 with code and requires an approved 0810.
+func (m *Manager) exchange(ctx context.Context, code string) (*iso8583.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	resp, err := m.link.SendAndWait(ctx, iso8583.NewNetworkRequest(code, m.cfg.NextSTAN()))
+	if err != nil {
+		return nil, err
+	}
+	if resp.MTI != "0810" {
+		return nil, fmt.Errorf("%s: unexpected response MTI %s", code, resp.MTI)
+	}
+	if rc, _ := resp.Get(39); rc != approvedRC {
+		return nil, fmt.Errorf("%s: declined with DE39=%s", code, rc)
+	}
+	return resp, nil
+}
+
+func (m *Manager) update(f func(*Status)) {
+	m.mu.Lock()
+	f(&m.st)
+	st := m.st
+	m.mu.Unlock()
+	if m.cfg.OnChange != nil {
+		m.cfg.OnChange(st)
+	}
+}
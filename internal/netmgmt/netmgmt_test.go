@@ -0,0 +1,132 @@
+package netmgmt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/inbound"
+	"go-payment-gateway/internal/iso8583"
+)
+
+type fakeLink struct {
+	mu    sync.Mutex
+	held  bool
+	codes []string
+	rc    string // DE39 returned to sign-on
+}
+
+func (l *fakeLink) SendAndWait(_ context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	code, _ := m.Get(70)
+	l.codes = append(l.codes, code)
+	if code == CodeSignOn && l.rc != approvedRC {
+		return inbound.NetworkResponse(m, l.rc), nil
+	}
+	r := inbound.Approve(m)
+	if code == CodeKeyRequest {
+		r.Set(48, "KEYBLOCK")
+	}
+	return r, nil
+}
+
+func (l *fakeLink) SetHeld(held bool) {
+	l.mu.Lock()
+	l.held = held
+	l.mu.Unlock()
+}
+
+func (l *fakeLink) isHeld() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.held
+}
+
+func waitState(t *testing.T, m *Manager, want State) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for m.Status().State != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("state %v, want %v", m.Status().State, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSignOnGatesTraffic(t *testing.T) {
+	link := &fakeLink{rc: "91"}
+	var key string
+	m := New(Config{Name: "test", NextSTAN: func() int { return 1 }, Retry: 10 * time.Millisecond, OnKey: func(k string) { key = k }}, link)
+	if !link.isHeld() {
+		t.Fatalf("link not held before sign-on")
+	}
+
+	m.LinkUp()
+	time.Sleep(30 * time.Millisecond)
+	if m.Status().State != StateSigningOn || !link.isHeld() || m.Status().LastError == "" {
+		t.Fatalf("declined sign-on released link: %+v", m.Status())
+	}
+	link.mu.Lock()
+	link.rc = approvedRC
+	link.mu.Unlock()
+	waitState(t, m, StateSignedOn)
+	if link.isHeld() {
+		t.Fatalf("link still held after sign-on")
+	}
+
+	if err := m.RequestKey(context.Background()); err != nil || key != "KEYBLOCK" {
+		t.Fatalf("RequestKey: %v, key %q", err, key)
+	}
+
+	m.LinkDown(errors.New("reset"))
+	if m.Status().State != StateDown || !link.isHeld() {
+		t.Fatalf("link down: %+v", m.Status())
+	}
+	m.LinkUp()
+	waitState(t, m, StateSignedOn)
+	if err := m.SignOff(context.Background()); err != nil {
+		t.Fatalf("SignOff: %v", err)
+	}
+	if m.Status().State != StateSignedOff || !link.isHeld() {
+		t.Fatalf("after sign-off: %+v", m.Status())
+	}
+	if last := link.codes[len(link.codes)-1]; last != CodeSignOff {
+		t.Fatalf("last code %s", last)
+	}
+}
+
+func TestHandleHostRequests(t *testing.T) {
+	link := &fakeLink{}
+	var key string
+	m := New(Config{NextSTAN: func() int { return 1 }, OnKey: func(k string) { key = k }}, link)
+	r := inbound.NewDefaultRegistry()
+	m.Register(r)
+
+	req := iso8583.NewNetworkRequest(CodeCutover, 42)
+	resp, ok := r.Dispatch(req)
+	if !ok || resp.MTI != "0810" || m.Status().LastCutover.IsZero() {
+		t.Fatalf("cutover not handled: %v %+v", ok, resp)
+	}
+	if rc, _ := resp.Get(39); rc != "00" {
+		t.Fatalf("DE39 = %q", rc)
+	}
+	if stan, _ := resp.Get(11); stan != "000042" {
+		t.Fatalf("DE11 = %q", stan)
+	}
+
+	req = iso8583.NewNetworkRequest(CodeKeyChange, 43)
+	req.Set(48, "NEWKEY")
+	if _, ok := r.Dispatch(req); !ok || key != "NEWKEY" {
+		t.Fatalf("key change not handled, key %q", key)
+	}
+
+	if _, ok := r.Dispatch(iso8583.NewNetworkRequest(CodeSignOn, 44)); !ok || link.isHeld() {
+		t.Fatalf("host sign-on did not release link")
+	}
+	if resp, ok := r.Dispatch(iso8583.NewEchoRequest(45)); !ok || resp.MTI != "0810" {
+		t.Fatalf("default echo handler replaced")
+	}
+}
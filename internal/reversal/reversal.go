@@ -0,0 +1,322 @@
+// Package reversal queues and retries 0400/0420 reversals for
+// authorizations whose outcome is unknown, typically after a timeout.
+package reversal
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+// Exchanger sends a request upstream and waits for its response.
+type Exchanger interface {
+	SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error)
+}
+
+// copied lists the original fields carried over into a reversal. DE14
+// (expiry) is deliberately left out: reversals are matched on DE90 and
+// the store must not hold card data it does not need.
+var copied = []int{2, 3, 4, 12, 13, 22, 25, 32, 37, 41, 42, 49}
+
+// fieldPAN is the primary account number, which is never written to the
+// store in the clear.
+const fieldPAN = 2
+
+// Build creates a reversal (0400) or reversal advice (0420) for orig. DE90
+// carries the original MTI, STAN, transmission time and acquirer ID.
+func Build(orig *iso8583.Message, advice bool, stan int, now time.Time) (*iso8583.Message, error) {
+	if len(orig.MTI) != 4 || (orig.MTI[1] != '1' && orig.MTI[1] != '2') {
+		return nil, fmt.Errorf("cannot reverse MTI %s", orig.MTI)
+	}
+	origSTAN, ok := orig.Get(11)
+	if !ok {
+		return nil, errors.New("original has no DE11")
+	}
+	origTime, ok := orig.Get(7)
+	if !ok {
+		return nil, errors.New("original has no DE7")
+	}
+	acq, _ := orig.Get(32)
+	if len(acq) > 11 {
+		return nil, fmt.Errorf("DE32 too long for DE90: %q", acq)
+	}
+
+	mti := "0400"
+	if advice {
+		mti = "0420"
+	}
+	r := iso8583.New(mti)
+	for _, f := range copied {
+		if v, ok := orig.Get(f); ok {
+			r.Set(f, v)
+		}
+	}
+	r.SetTransmissionTime(now)
+	r.SetSTAN(stan)
+	r.Set(90, orig.MTI+origSTAN+origTime+fmt.Sprintf("%011s", acq)+strings.Repeat("0", 11))
+	return r, nil
+}
+
+// Pending is a reversal waiting for its 0410/0430. Fields never holds
+// DE2; PAN carries it sealed with the store key, if one is configured.
+type Pending struct {
+	MTI      string         `json:"mti"`
+	Fields   map[int]string `json:"fields"`
+	PAN      string         `json:"pan,omitempty"`
+	Attempts int            `json:"attempts"`
+	Created  time.Time      `json:"created"`
+	LastTry  time.Time      `json:"last_try,omitempty"`
+	LastErr  string         `json:"last_err,omitempty"`
+}
+
+// Key identifies a pending reversal by its DE90 original data elements.
+func (p *Pending) Key() string { return p.Fields[90] }
+
+func (p *Pending) message(aead cipher.AEAD) (*iso8583.Message, error) {
+	m := iso8583.New(p.MTI)
+	for f, v := range p.Fields {
+		m.Set(f, v)
+	}
+	if p.PAN != "" {
+		pan, err := open(aead, p.PAN)
+		if err != nil {
+			return nil, fmt.Errorf("DE2: %w", err)
+		}
+		m.Set(fieldPAN, pan)
+	}
+	if p.Attempts > 0 {
+		// Repeats: 0400 -> 0401, 0420 -> 0421.
+		m.MTI = p.MTI[:3] + "1"
+	}
+	return m, nil
+}
+
+// Config configures a Manager.
+//
+// The store at Path is created with mode 0600 and holds no expiry date
+// and no clear PAN. With a Key, DE2 is sealed with AES-GCM so reversals
+// still carry it after a restart; without one DE2 is dropped and the
+// reversal is identified upstream by DE90 alone.
+type Config struct {
+	Path     string        // JSON file holding pending reversals
+	Key      []byte        // AES key (16, 24 or 32 bytes) sealing DE2 in the store
+	Advice   bool          // send 0420 advices instead of 0400 requests
+	Interval time.Duration // delay between delivery attempts
+	NextSTAN func() int
+}
+
+// Manager persists pending reversals and resends them until acknowledged.
+type Manager struct {
+	cfg  Config
+	ex   Exchanger
+	aead cipher.AEAD // nil without Config.Key
+
+	mu      sync.Mutex
+	pending map[string]*Pending
+	wake    chan struct{}
+}
+
+// NewManager creates a manager and loads any reversals left on disk by a
+// previous run.
+func NewManager(cfg Config, ex Exchanger) (*Manager, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	m := &Manager{cfg: cfg, ex: ex, pending: make(map[string]*Pending), wake: make(chan struct{}, 1)}
+	if cfg.Key != nil {
+		block, err := aes.NewCipher(cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("store key: %w", err)
+		}
+		if m.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("store key: %w", err)
+		}
+	}
+	b, err := os.ReadFile(cfg.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return m, nil
+	case err != nil:
+		return nil, err
+	}
+	var list []*Pending
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("load %s: %w", cfg.Path, err)
+	}
+	for _, p := range list {
+		m.pending[p.Key()] = p
+	}
+	return m, nil
+}
+
+// Add queues a reversal for orig and persists it before returning.
+func (m *Manager) Add(orig *iso8583.Message) error {
+	r, err := Build(orig, m.cfg.Advice, m.cfg.NextSTAN(), time.Now())
+	if err != nil {
+		return err
+	}
+	p := &Pending{MTI: r.MTI, Fields: r.Fields, Created: time.Now()}
+	if pan, ok := p.Fields[fieldPAN]; ok {
+		delete(p.Fields, fieldPAN)
+		if m.aead != nil {
+			if p.PAN, err = seal(m.aead, pan); err != nil {
+				return err
+			}
+		}
+	}
+	m.mu.Lock()
+	m.pending[p.Key()] = p
+	err = m.saveLocked()
+	m.mu.Unlock()
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// List returns a snapshot of the pending reversals, oldest first.
+func (m *Manager) List() []Pending {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Pending, 0, len(m.pending))
+	for _, p := range m.pending {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out
+}
+
+// Run delivers pending reversals until ctx is done.
+func (m *Manager) Run(ctx context.Context) {
+	t := time.NewTicker(m.cfg.Interval)
+	defer t.Stop()
+	for {
+		for _, p := range m.List() {
+			if ctx.Err() != nil {
+				return
+			}
+			m.attempt(ctx, p.Key())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-m.wake:
+		}
+	}
+}
+
+func (m *Manager) attempt(ctx context.Context, key string) {
+	m.mu.Lock()
+	p, ok := m.pending[key]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	req, err := p.message(m.aead)
+	m.mu.Unlock()
+
+	var resp *iso8583.Message
+	if err == nil {
+		resp, err = m.ex.SendAndWait(ctx, req)
+	}
+	if err == nil && !isAck(resp.MTI) {
+		err = fmt.Errorf("unexpected response MTI %s", resp.MTI)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		rc, _ := resp.Get(39)
+		log.Printf("reversal %s acknowledged with %s, DE39=%s", req.MTI, resp.MTI, rc)
+		delete(m.pending, key)
+	} else {
+		log.Printf("reversal %s attempt %d failed: %v", p.MTI, p.Attempts+1, err)
+		p.Attempts++
+		p.LastTry = time.Now()
+		p.LastErr = err.Error()
+	}
+	if err := m.saveLocked(); err != nil {
+		log.Printf("reversal store: %v", err)
+	}
+}
+
+func isAck(mti string) bool {
+	return len(mti) == 4 && mti[1] == '4' && (mti[2] == '1' || mti[2] == '3')
+}
+
+// seal encrypts s with a random nonce and returns nonce||ciphertext in
+// base64.
+func seal(aead cipher.AEAD, s string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(s), nil)), nil
+}
+
+// open reverses seal.
+func open(aead cipher.AEAD, s string) (string, error) {
+	if aead == nil {
+		return "", errors.New("sealed in the store but no key configured")
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	n := aead.NonceSize()
+	if len(b) < n {
+		return "", errors.New("sealed value too short")
+	}
+	pt, err := aead.Open(nil, b[:n], b[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+// saveLocked atomically rewrites the store file, which os.CreateTemp
+// creates with mode 0600. Caller holds m.mu.
+func (m *Manager) saveLocked() error {
+	list := make([]*Pending, 0, len(m.pending))
+	for _, p := range m.pending {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.cfg.Path), ".reversals-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.cfg.Path)
+}
@@ -0,0 +1,138 @@
+package reversal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+func original() *iso8583.Message {
+	m := iso8583.New("0200")
+	m.Set(2, "4111111111111111")
+	m.Set(3, "000000")
+	m.Set(4, "000000001000")
+	m.Set(7, "0102030405")
+	m.Set(11, "123456")
+	m.Set(32, "12345")
+	m.Set(41, "TERM0001")
+	return m
+}
+
+func TestBuild(t *testing.T) {
+	r, err := Build(original(), false, 77, time.Now())
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if r.MTI != "0400" {
+		t.Fatalf("MTI %q", r.MTI)
+	}
+	want := "0200" + "123456" + "0102030405" + "00000012345" + "00000000000"
+	if v, _ := r.Get(90); v != want {
+		t.Fatalf("DE90 = %q, want %q", v, want)
+	}
+	if v, _ := r.Get(11); v != "000077" {
+		t.Fatalf("DE11 = %q", v)
+	}
+	if _, err := r.Pack(iso8583.DefaultSpec); err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+}
+
+type exchangerFunc func(*iso8583.Message) (*iso8583.Message, error)
+
+func (f exchangerFunc) SendAndWait(_ context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+	return f(m)
+}
+
+func TestManagerPersistsUntilAcknowledged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reversals.json")
+	cfg := Config{Path: path, Advice: true, Interval: time.Hour, NextSTAN: func() int { return 1 }}
+
+	var sent []string
+	fail := exchangerFunc(func(m *iso8583.Message) (*iso8583.Message, error) {
+		sent = append(sent, m.MTI)
+		return nil, context.DeadlineExceeded
+	})
+	m, err := NewManager(cfg, fail)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if err := m.Add(original()); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	m.attempt(context.Background(), m.List()[0].Fields[90])
+
+	// A restart must pick the reversal up again and send it as a repeat.
+	ack := exchangerFunc(func(m *iso8583.Message) (*iso8583.Message, error) {
+		sent = append(sent, m.MTI)
+		return iso8583.New("0430"), nil
+	})
+	m2, err := NewManager(cfg, ack)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	list := m2.List()
+	if len(list) != 1 || list[0].Attempts != 1 {
+		t.Fatalf("reloaded %+v", list)
+	}
+	m2.attempt(context.Background(), list[0].Key())
+	if len(m2.List()) != 0 {
+		t.Fatalf("reversal still pending after 0430")
+	}
+	if len(sent) != 2 || sent[0] != "0420" || sent[1] != "0421" {
+		t.Fatalf("sent %v", sent)
+	}
+}
+
+func TestStoreHoldsNoClearCardData(t *testing.T) {
+	orig := original()
+	orig.Set(14, "2612")
+	for _, key := range [][]byte{nil, []byte("0123456789abcdef0123456789abcdef")} {
+		path := filepath.Join(t.TempDir(), "reversals.json")
+		cfg := Config{Path: path, Key: key, Interval: time.Hour, NextSTAN: func() int { return 1 }}
+		var got *iso8583.Message
+		ex := exchangerFunc(func(m *iso8583.Message) (*iso8583.Message, error) {
+			got = m
+			return iso8583.New("0410"), nil
+		})
+		m, err := NewManager(cfg, ex)
+		if err != nil {
+			t.Fatalf("NewManager: %v", err)
+		}
+		if err := m.Add(orig); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b, []byte("4111111111111111")) || bytes.Contains(b, []byte("2612")) {
+			t.Fatalf("store holds clear card data:\n%s", b)
+		}
+		if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+			t.Fatalf("store mode %v, %v", fi.Mode(), err)
+		}
+
+		// After a restart the reversal carries DE2 only if it was sealed.
+		m2, err := NewManager(cfg, ex)
+		if err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+		m2.attempt(context.Background(), m2.List()[0].Key())
+		pan, ok := got.Get(2)
+		if key != nil && pan != "4111111111111111" {
+			t.Fatalf("key set: DE2 = %q", pan)
+		}
+		if key == nil && ok {
+			t.Fatalf("no key: DE2 = %q sent", pan)
+		}
+		if _, ok := got.Get(14); ok {
+			t.Fatalf("reversal carries DE14")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/transport"
+)
+
+// Fault makes the host misbehave when answering a request.
+type Fault int
+
+const (
+	FaultNone         Fault = iota
+	FaultDropMidFrame       // write half of the response frame, then close
+	FaultTruncatedMLI       // write the first byte of the MLI, then close
+	FaultGarbage            // write bytes that are not a valid frame
+	FaultWrongSTAN          // answer with a different DE11
+	FaultDuplicate          // send the response twice
+	FaultSplitWrites        // write the frame in several TCP segments
+)
+
+var faultNames = [...]string{"none", "drop-mid-frame", "truncated-mli", "garbage", "wrong-stan", "duplicate", "split-writes"}
+
+func (f Fault) String() string {
+	if int(f) < len(faultNames) {
+		return faultNames[f]
+	}
+	return fmt.Sprintf("Fault(%d)", int(f))
+}
+
+// ParseFault maps a fault name such as "wrong-stan" to a Fault.
+func ParseFault(s string) (Fault, error) {
+	for i, n := range faultNames {
+		if n == s {
+			return Fault(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown fault %q", s)
+}
+
+func (f Fault) MarshalText() ([]byte, error) { return []byte(f.String()), nil }
+
+func (f *Fault) UnmarshalText(b []byte) error {
+	v, err := ParseFault(string(b))
+	if err != nil {
+		return err
+	}
+	*f = v
+	return nil
+}
+
+// garbage starts with an all-ones MLI so that no framer sees a short frame.
+var garbage = []byte("\xff\xff\xff\xffNOT-AN-ISO8583-MESSAGE")
+
+// send writes the framed response body b to sess, applying fault.
+func send(sess *transport.Session, framer transport.Framer, b []byte, fault Fault) error {
+	var frame bytes.Buffer
+	if err := framer.WriteFrame(&frame, b); err != nil {
+		return err
+	}
+	raw := frame.Bytes()
+	switch fault {
+	case FaultDropMidFrame:
+		err := sess.WriteRaw(raw[:len(raw)/2])
+		sess.Close()
+		return err
+	case FaultTruncatedMLI:
+		err := sess.WriteRaw(raw[:1])
+		sess.Close()
+		return err
+	case FaultGarbage:
+		return sess.WriteRaw(garbage)
+	case FaultDuplicate:
+		if err := sess.WriteRaw(raw); err != nil {
+			return err
+		}
+		return sess.WriteRaw(raw)
+	case FaultSplitWrites:
+		for len(raw) > 0 {
+			n := min(3, len(raw))
+			if err := sess.WriteRaw(raw[:n]); err != nil {
+				return err
+			}
+			raw = raw[n:]
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	}
+	return sess.WriteRaw(raw)
+}
+
+func logFault(f Fault, req *iso8583.Message) {
+	if f != FaultNone {
+		stan, _ := req.Get(11)
+		log.Printf("fault %s on STAN=%s", f, stan)
+	}
+}
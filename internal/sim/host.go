@@ -0,0 +1,218 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go-payment-gateway/internal/inbound"
+	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/transport"
+)
+
+// echoed lists the request fields copied into financial responses.
+var echoed = []int{2, 3, 4, 7, 11, 12, 13, 14, 22, 32, 37, 41, 42, 49, 90}
+
+// Host answers requests according to a Scenario. Without a matching rule it
+// approves everything.
+type Host struct {
+	scenario *Scenario
+	seq      atomic.Uint64 // source of generated DE37/DE38
+}
+
+// NewHost creates a host playing sc, which may be nil.
+func NewHost(sc *Scenario) *Host {
+	return &Host{scenario: sc}
+}
+
+// Reply is the host's decision for one request.
+type Reply struct {
+	Rule     *Rule            // matching rule, nil for the default
+	Response *iso8583.Message // nil when no response is sent
+	Delay    time.Duration
+	Stall    time.Duration
+	Fault    Fault
+}
+
+// Respond decides how to answer req.
+func (h *Host) Respond(req *iso8583.Message) Reply {
+	rule := h.scenario.Match(req)
+	r := Reply{Rule: rule}
+	if rule == nil {
+		rule = &Rule{}
+	}
+	r.Delay, r.Stall, r.Fault = time.Duration(rule.Delay), time.Duration(rule.Stall), rule.Fault
+	if rule.NoResponse || len(req.MTI) != 4 || transport.IsResponse(req.MTI) {
+		return r
+	}
+	rc := rule.ResponseCode
+	if rc == "" {
+		rc = "00"
+	}
+	if req.MTI[1] == '8' {
+		r.Response = inbound.NetworkResponse(req, rc)
+		r.applyFault()
+		return r
+	}
+
+	resp := iso8583.New(iso8583.ResponseMTI(req.MTI))
+	for _, f := range echoed {
+		if v, ok := req.Get(f); ok {
+			resp.Set(f, v)
+		}
+	}
+	n := h.seq.Add(1)
+	if _, ok := resp.Get(37); !ok {
+		now := time.Now().UTC()
+		resp.Set(37, fmt.Sprintf("%d%03d%02d%06d", now.Year()%10, now.YearDay(), now.Hour(), n%1000000))
+	}
+	if rc == "00" && req.MTI[1] != '4' {
+		auth := rule.AuthCode
+		if auth == "" {
+			auth = fmt.Sprintf("%06d", n%1000000)
+		}
+		resp.Set(38, auth)
+	}
+	resp.Set(39, rc)
+	r.Response = resp
+	r.applyFault()
+	return r
+}
+
+// applyFault alters the response for faults that change its content.
+func (r *Reply) applyFault() {
+	if r.Fault == FaultWrongSTAN {
+		stan, _ := r.Response.Get(11)
+		n, _ := strconv.Atoi(stan)
+		r.Response.Set(11, fmt.Sprintf("%06d", (n+1)%1000000))
+	}
+}
+
+// Config configures a Server.
+type Config struct {
+	Addr     string
+	Spec     *iso8583.Spec // DefaultSpec if nil
+	Framer   transport.Framer
+	Scenario *Scenario
+	ReadIdle time.Duration
+
+	// Defaults for requests whose rule sets no fault or stall, usually
+	// from command-line flags.
+	Fault      Fault
+	Stall      time.Duration
+	CloseAfter int // overrides the scenario's close_after when set
+}
+
+// Server is a simulated acquirer listening for gateway connections.
+type Server struct {
+	cfg  Config
+	ln   *transport.Listener
+	host *Host
+}
+
+// Listen starts listening; call Serve to accept connections.
+func Listen(cfg Config) (*Server, error) {
+	if cfg.Spec == nil {
+		cfg.Spec = iso8583.DefaultSpec
+	}
+	if cfg.Framer == nil {
+		cfg.Framer = transport.DefaultFramer
+	}
+	if cfg.CloseAfter == 0 && cfg.Scenario != nil {
+		cfg.CloseAfter = cfg.Scenario.CloseAfter
+	}
+	s := &Server{cfg: cfg, host: NewHost(cfg.Scenario)}
+	ln, err := transport.Listen(transport.ListenConfig{
+		Addr:     cfg.Addr,
+		ReadIdle: cfg.ReadIdle,
+		Framer:   cfg.Framer,
+		OnAccept: s.accept,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.ln = ln
+	return s, nil
+}
+
+// Serve accepts connections until Shutdown.
+func (s *Server) Serve() error { return s.ln.Serve() }
+
+// Addr returns the listening address.
+func (s *Server) Addr() net.Addr { return s.ln.Addr() }
+
+// Shutdown stops accepting and closes sessions still open when ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error { return s.ln.Shutdown(ctx) }
+
+func (s *Server) accept(sess *transport.Session) {
+	log.Printf("client %s connected", sess.RemoteAddr())
+	var received int
+	sess.SetCallbacks(
+		func(payload []byte) {
+			received++
+			s.handle(sess, payload)
+			if s.cfg.CloseAfter > 0 && received >= s.cfg.CloseAfter {
+				log.Printf("closing %s after %d messages", sess.RemoteAddr(), received)
+				sess.Close()
+			}
+		},
+		func(err error) { log.Printf("client %s disconnected: %v", sess.RemoteAddr(), err) },
+	)
+}
+
+func (s *Server) handle(sess *transport.Session, payload []byte) {
+	if err := s.cfg.Spec.VerifyMAC(payload); err != nil {
+		log.Printf("dropping request: %v", err)
+		return
+	}
+	msg, err := iso8583.Unpack(s.cfg.Spec, payload)
+	if err != nil {
+		log.Printf("unpack: %v", err)
+		return
+	}
+	reply := s.host.Respond(msg)
+	rule := "default"
+	if reply.Rule != nil && reply.Rule.Name != "" {
+		rule = reply.Rule.Name
+	}
+	log.Printf("RX %s (rule %s)", msg, rule)
+	if reply.Fault == FaultNone && s.cfg.Fault != FaultNone {
+		reply.Fault = s.cfg.Fault
+		if reply.Response != nil {
+			reply.applyFault()
+		}
+	}
+	if reply.Stall == 0 {
+		reply.Stall = s.cfg.Stall
+	}
+	if reply.Stall > 0 {
+		log.Printf("stalling %s for %s", sess.RemoteAddr(), reply.Stall)
+		time.Sleep(reply.Stall) // blocks this session's read loop
+	}
+	if reply.Response == nil {
+		return
+	}
+	b, err := reply.Response.Pack(s.cfg.Spec)
+	if err != nil {
+		log.Printf("pack resp: %v", err)
+		return
+	}
+	write := func() {
+		logFault(reply.Fault, msg)
+		if err := send(sess, s.cfg.Framer, b, reply.Fault); err != nil {
+			log.Printf("write resp: %v", err)
+			sess.Close()
+			return
+		}
+		log.Printf("TX %s", reply.Response)
+	}
+	if reply.Delay > 0 {
+		time.AfterFunc(reply.Delay, write)
+		return
+	}
+	write()
+}
@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/transport"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestServerLogsNoCardholderData(t *testing.T) {
+	var logs syncBuffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	srv, err := Listen(Config{Addr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	defer srv.Shutdown(context.Background())
+
+	conn := transport.NewConnector(transport.DialConfig{Endpoint: srv.Addr().String(), Timeout: time.Second, ReadIdle: 5 * time.Second})
+	corr := transport.NewCorrelator(conn, nil, time.Second)
+	up := make(chan struct{}, 1)
+	conn.SetCallbacks(func(b []byte) {
+		if m, err := iso8583.Unpack(iso8583.DefaultSpec, b); err == nil {
+			corr.Deliver(m)
+		}
+	}, func() { up <- struct{}{} }, nil)
+	conn.Start()
+	defer conn.Close()
+	<-up
+
+	const pan = "4761739001010119"
+	req := purchase(pan, "000000001000", "TERM0001")
+	req.Set(35, pan+"=29122011758928889")
+	req.Set(37, "000000000001")
+	req.Set(52, "0123456789ABCDEF")
+	if _, err := corr.SendAndWait(context.Background(), req); err != nil {
+		t.Fatalf("SendAndWait: %v\n%s", err, logs.String())
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "476173******0119") {
+		t.Fatalf("expected masked PAN in logs:\n%s", out)
+	}
+	if strings.Contains(out, pan) || strings.Contains(out, "0123456789ABCDEF") {
+		t.Fatalf("cardholder data in logs:\n%s", out)
+	}
+}
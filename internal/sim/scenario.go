@@ -0,0 +1,148 @@
+// Package sim is a scriptable acquirer host used by cmd/simnet and by
+// integration tests.
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+// Duration is a time.Duration written as "250ms" or "2s" in scenario files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(time.Duration(d).String()), nil }
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rule matches requests and decides how the host answers them. Empty match
+// fields match anything; list fields match if any entry does.
+type Rule struct {
+	Name string `json:"name,omitempty"`
+
+	MTI            []string `json:"mti,omitempty"`
+	ProcessingCode []string `json:"processing_code,omitempty"` // DE3 prefixes, e.g. "00" for purchases
+	AmountMin      int64    `json:"amount_min,omitempty"`      // DE4 in minor units, inclusive
+	AmountMax      int64    `json:"amount_max,omitempty"`      // inclusive, 0 is unbounded
+	PANPrefix      []string `json:"pan_prefix,omitempty"`
+	TerminalID     []string `json:"terminal_id,omitempty"` // DE41, exact
+
+	ResponseCode string   `json:"response_code,omitempty"` // DE39, "00" if empty
+	AuthCode     string   `json:"auth_code,omitempty"`     // DE38, generated for approvals if empty
+	Delay        Duration `json:"delay,omitempty"`
+	NoResponse   bool     `json:"no_response,omitempty"`
+	Fault        Fault    `json:"fault,omitempty"`
+	Stall        Duration `json:"stall,omitempty"` // block the session before answering
+}
+
+// Matches reports whether m satisfies every condition of the rule.
+func (r *Rule) Matches(m *iso8583.Message) bool {
+	if len(r.MTI) > 0 && !contains(r.MTI, m.MTI) {
+		return false
+	}
+	if len(r.ProcessingCode) > 0 && !hasPrefix(r.ProcessingCode, field(m, 3)) {
+		return false
+	}
+	if len(r.PANPrefix) > 0 && !hasPrefix(r.PANPrefix, field(m, 2)) {
+		return false
+	}
+	if len(r.TerminalID) > 0 && !contains(r.TerminalID, strings.TrimSpace(field(m, 41))) {
+		return false
+	}
+	if r.AmountMin > 0 || r.AmountMax > 0 {
+		amt, err := strconv.ParseInt(field(m, 4), 10, 64)
+		if err != nil || amt < r.AmountMin || (r.AmountMax > 0 && amt > r.AmountMax) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scenario is an ordered rule list; the first matching rule wins.
+type Scenario struct {
+	Rules []Rule `json:"rules"`
+	// CloseAfter closes each session after it received this many messages.
+	CloseAfter int `json:"close_after,omitempty"`
+}
+
+// Match returns the first rule matching m, or nil.
+func (s *Scenario) Match(m *iso8583.Message) *Rule {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Rules {
+		if s.Rules[i].Matches(m) {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
+
+// ParseScenario reads a JSON scenario.
+func ParseScenario(r io.Reader) (*Scenario, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var s Scenario
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	for i, rule := range s.Rules {
+		if rule.AmountMax > 0 && rule.AmountMax < rule.AmountMin {
+			return nil, fmt.Errorf("rule %d: amount_max below amount_min", i)
+		}
+		if len(rule.ResponseCode) > 0 && len(rule.ResponseCode) != 2 {
+			return nil, fmt.Errorf("rule %d: response_code must be 2 characters", i)
+		}
+	}
+	return &s, nil
+}
+
+// LoadScenario reads a JSON scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ParseScenario(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func field(m *iso8583.Message, f int) string {
+	v, _ := m.Get(f)
+	return v
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(prefixes []string, v string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(v, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package sim
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+func purchase(pan, amount, tid string) *iso8583.Message {
+	m := iso8583.New("0200")
+	m.Set(2, pan)
+	m.Set(3, "000000")
+	m.Set(4, amount)
+	m.Set(7, "0102030405")
+	m.Set(11, "000123")
+	m.Set(41, tid)
+	return m
+}
+
+func TestExampleScenario(t *testing.T) {
+	f, err := os.Open("../../scenarios/example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc, err := ParseScenario(f)
+	if err != nil {
+		t.Fatalf("ParseScenario: %v", err)
+	}
+	h := NewHost(sc)
+
+	cases := []struct {
+		req      *iso8583.Message
+		rule, rc string
+		auth     bool
+	}{
+		{purchase("4111111111111111", "000000001000", "TERM0001"), "", "00", true},
+		{purchase("4111111111111111", "000000100000", "TERM0001"), "insufficient funds", "51", false},
+		{purchase("4000000000000002", "000000001000", "TERM0001"), "lost card", "41", false},
+		{purchase("5500000000000004", "000000001000", "TERM0001"), "fixed auth code", "00", true},
+	}
+	for _, c := range cases {
+		r := h.Respond(c.req)
+		name := ""
+		if r.Rule != nil {
+			name = r.Rule.Name
+		}
+		if name != c.rule {
+			t.Fatalf("matched %q, want %q", name, c.rule)
+		}
+		resp := r.Response
+		if resp.MTI != "0210" {
+			t.Fatalf("MTI %s", resp.MTI)
+		}
+		if rc, _ := resp.Get(39); rc != c.rc {
+			t.Fatalf("%s: DE39 = %q, want %q", c.rule, rc, c.rc)
+		}
+		if _, ok := resp.Get(38); ok != c.auth {
+			t.Fatalf("%s: DE38 present = %v", c.rule, ok)
+		}
+		if rrn, _ := resp.Get(37); len(rrn) != 12 {
+			t.Fatalf("DE37 = %q", rrn)
+		}
+		if stan, _ := resp.Get(11); stan != "000123" {
+			t.Fatalf("DE11 = %q", stan)
+		}
+		if _, err := resp.Pack(iso8583.DefaultSpec); err != nil {
+			t.Fatalf("Pack: %v", err)
+		}
+	}
+
+	if r := h.Respond(purchase("4111111111111111", "000000001000", "TIMEOUT1")); r.Response != nil {
+		t.Fatalf("timeout rule answered")
+	}
+	if r := h.Respond(purchase("4111111111111111", "000000001000", "SLOW0001")); r.Delay != 3*time.Second {
+		t.Fatalf("delay %v", r.Delay)
+	}
+	if r := h.Respond(purchase("5500000000000004", "000000001000", "TERM0001")); r.Response.Fields[38] != "A1B2C3" {
+		t.Fatalf("auth code %q", r.Response.Fields[38])
+	}
+	if r := h.Respond(iso8583.NewEchoRequest(1)); r.Response == nil || r.Response.MTI != "0810" {
+		t.Fatalf("echo not answered")
+	}
+	if r := h.Respond(iso8583.New("0810")); r.Response != nil {
+		t.Fatalf("answered a response")
+	}
+}
+
+func TestParseScenarioRejects(t *testing.T) {
+	for _, in := range []string{
+		`{"rules":[{"amount_min":10,"amount_max":5}]}`,
+		`{"rules":[{"response_code":"005"}]}`,
+		`{"rules":[{"delay":"soon"}]}`,
+		`{"rules":[{"unknown":true}]}`,
+	} {
+		if _, err := ParseScenario(strings.NewReader(in)); err == nil {
+			t.Errorf("accepted %s", in)
+		}
+	}
+}
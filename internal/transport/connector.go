@@ -3,9 +3,6 @@ package transport
 import (
 	"bufio"
 	"crypto/tls"
-	"encoding/binary"
-	"fmt"
-	"io"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -15,11 +12,15 @@ import (
 // DialConfig holds connection options.
 type DialConfig struct {
 	Endpoint   string        // host:port
-	TLS        bool          // enable TLS
+	TLS        *TLSOptions   // nil = plain TCP
 	Timeout    time.Duration // dial timeout
 	KeepAlive  time.Duration // TCP keepalive
 	ReadIdle   time.Duration // optional read deadline extension per read
 	RetryBacko time.Duration // base backoff between reconnect attempts
+	Framer     Framer        // message framing, DefaultFramer if nil
+	// Verify, if set, checks each received message body, e.g. its MAC.
+	// Messages failing it are dropped and counted in Rejected.
+	Verify func(payload []byte) error
 }
 
 // Connector manages one persistent TCP connection.
@@ -27,19 +28,29 @@ type Connector struct {
 	cfg    DialConfig
 	mu     sync.RWMutex
 	conn   net.Conn
+	tls    *TLSInfo
 	closed atomic.Bool
+	reject atomic.Uint64
 
-	onMsg  func([]byte) // callback on full ISO message (including MLI)
+	onMsg  func([]byte) // callback on each ISO message body (framing removed)
 	onUp   func()
 	onDown func(error)
 }
 
-func NewConnector(cfg DialConfig) *Connector { return &Connector{cfg: cfg} }
+func NewConnector(cfg DialConfig) *Connector {
+	if cfg.Framer == nil {
+		cfg.Framer = DefaultFramer
+	}
+	return &Connector{cfg: cfg}
+}
 
 func (c *Connector) SetCallbacks(onMsg func([]byte), onUp func(), onDown func(error)) {
 	c.onMsg, c.onUp, c.onDown = onMsg, onUp, onDown
 }
 
+// Rejected returns how many received messages failed DialConfig.Verify.
+func (c *Connector) Rejected() uint64 { return c.reject.Load() }
+
 // Start runs the connect/reconnect loop in a goroutine.
 func (c *Connector) Start() { go c.loop() }
 
@@ -80,8 +91,18 @@ func (c *Connector) dial() error {
 		conn net.Conn
 		err  error
 	)
-	if c.cfg.TLS {
-		conn, err = tls.DialWithDialer(d, "tcp", c.cfg.Endpoint, &tls.Config{InsecureSkipVerify: true})
+	var info *TLSInfo
+	if c.cfg.TLS != nil {
+		tcfg, cerr := c.cfg.TLS.Config(c.cfg.Endpoint)
+		if cerr != nil {
+			return cerr
+		}
+		var tc *tls.Conn
+		tc, err = tls.DialWithDialer(d, "tcp", c.cfg.Endpoint, tcfg)
+		if err == nil {
+			info = newTLSInfo(tc.ConnectionState(), tcfg)
+			conn = tc
+		}
 	} else {
 		conn, err = d.Dial("tcp", c.cfg.Endpoint)
 	}
@@ -90,10 +111,22 @@ func (c *Connector) dial() error {
 	}
 	c.mu.Lock()
 	c.conn = conn
+	c.tls = info
 	c.mu.Unlock()
 	return nil
 }
 
+// TLSInfo returns the handshake state of the current connection, or nil
+// when not connected or not using TLS.
+func (c *Connector) TLSInfo() *TLSInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.tls
+}
+
 func (c *Connector) readLoop() error {
 	c.mu.RLock()
 	conn := c.conn
@@ -105,41 +138,32 @@ func (c *Connector) readLoop() error {
 	reader := bufio.NewReader(conn)
 	for !c.closed.Load() {
 		_ = conn.SetReadDeadline(time.Now().Add(c.cfg.ReadIdle))
-		// Read MLI 2 bytes
-		mliBytes := make([]byte, 2)
-		if _, err := io.ReadFull(reader, mliBytes); err != nil {
+		msg, err := c.cfg.Framer.ReadFrame(reader)
+		if err != nil {
 			c.closeConn()
 			return err
 		}
-		mli := int(binary.BigEndian.Uint16(mliBytes))
-		if mli <= 0 || mli > (64*1024) { // sanity
-			c.closeConn()
-			return fmt.Errorf("invalid MLI %d", mli)
-		}
-		payload := make([]byte, mli)
-		if _, err := io.ReadFull(reader, payload); err != nil {
-			c.closeConn()
-			return err
+		if c.cfg.Verify != nil && c.cfg.Verify(msg) != nil {
+			c.reject.Add(1)
+			continue
 		}
-		full := append(mliBytes, payload...)
 		if c.onMsg != nil {
-			c.onMsg(full)
+			c.onMsg(msg)
 		}
 	}
 	return nil
 }
 
-// Send writes a full wire message (already has MLI prefix).
+// Send frames and writes one message body.
 func (c *Connector) Send(b []byte) error {
 	c.mu.RLock()
 	conn := c.conn
 	c.mu.RUnlock()
 	if conn == nil {
-		return fmt.Errorf("not connected")
+		return ErrNotConnected
 	}
 	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-	_, err := conn.Write(b)
-	return err
+	return c.cfg.Framer.WriteFrame(conn, b)
 }
 
 func (c *Connector) closeConn() {
@@ -147,10 +171,14 @@ func (c *Connector) closeConn() {
 	if c.conn != nil {
 		_ = c.conn.Close()
 		c.conn = nil
+		c.tls = nil
 	}
 	c.mu.Unlock()
 }
 
+// Reconnect drops the current connection; the connect loop dials again.
+func (c *Connector) Reconnect() { c.closeConn() }
+
 func (c *Connector) Close() {
 	c.closed.Store(true)
 	c.closeConn()
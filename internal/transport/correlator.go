@@ -0,0 +1,216 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+var (
+	// ErrTimeout is returned by SendAndWait when no response arrives in time.
+	ErrTimeout = errors.New("response timeout")
+	// ErrDuplicateKey is returned when a request with the same match key is
+	// already waiting for its response.
+	ErrDuplicateKey = errors.New("duplicate request in flight")
+	// ErrNotConnected is returned by Send when there is no connection; the
+	// message was not written.
+	ErrNotConnected = errors.New("not connected")
+)
+
+// Sender is anything that can write a packed message upstream.
+type Sender interface {
+	Send(b []byte) error
+}
+
+// MatchKey identifies a request/response pair: MTI class (version and
+// class digits) plus the fields a host echoes back in its response.
+type MatchKey struct {
+	Class  string // first two MTI digits, e.g. "08" for 0800/0810
+	STAN   string // DE11
+	Time   string // DE7
+	TermID string // DE41
+	RRN    string // DE37
+}
+
+func (k MatchKey) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", k.Class, k.STAN, k.Time, k.TermID, k.RRN)
+}
+
+// KeyOf builds the correlation key for a request or response message.
+func KeyOf(m *iso8583.Message) MatchKey {
+	k := MatchKey{}
+	if len(m.MTI) >= 2 {
+		k.Class = m.MTI[:2]
+	}
+	k.STAN, _ = m.Get(11)
+	k.Time, _ = m.Get(7)
+	k.TermID, _ = m.Get(41)
+	k.RRN, _ = m.Get(37)
+	return k
+}
+
+// IsResponse reports whether the MTI function digit marks a response
+// (x1x0 response, x1x2/x1x3 advice response and their repeats).
+func IsResponse(mti string) bool {
+	if len(mti) != 4 {
+		return false
+	}
+	return mti[2] == '1' || mti[2] == '3'
+}
+
+// Outcomes reported to a Correlator observer.
+const (
+	OutcomeSent        = "sent"        // request written upstream
+	OutcomeSendFailed  = "send_failed" // request could not be written
+	OutcomeTimeout     = "timeout"     // no response before the deadline
+	OutcomeMatched     = "matched"     // response completed a request
+	OutcomeOrphan      = "orphan"      // response matched nothing
+	OutcomeUnsolicited = "unsolicited" // inbound request, left to the caller
+)
+
+// Event reports one message passing through a Correlator.
+type Event struct {
+	Outbound bool
+	Msg      *iso8583.Message
+	Key      MatchKey
+	Outcome  string
+}
+
+type waiter struct {
+	ch chan *iso8583.Message
+}
+
+// Correlator pairs outbound requests with inbound responses sent over a
+// Sender. Inbound messages are fed to it through Deliver.
+type Correlator struct {
+	s       Sender
+	spec    *iso8583.Spec
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[MatchKey]*waiter
+
+	orphans  atomic.Uint64
+	onOrphan func(*iso8583.Message)
+	observe  func(Event)
+}
+
+// NewCorrelator creates a correlator that packs requests with spec.
+// timeout applies to every request unless the caller's context expires
+// earlier.
+func NewCorrelator(s Sender, spec *iso8583.Spec, timeout time.Duration) *Correlator {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &Correlator{s: s, spec: spec, timeout: timeout, pending: make(map[MatchKey]*waiter)}
+}
+
+// SetOrphanHandler registers a callback for responses that match no
+// pending request, including responses arriving after their timeout.
+func (c *Correlator) SetOrphanHandler(fn func(*iso8583.Message)) { c.onOrphan = fn }
+
+// SetObserver registers a callback for every request sent and message
+// delivered, e.g. to journal them. Requests that time out are reported a
+// second time with OutcomeTimeout.
+func (c *Correlator) SetObserver(fn func(Event)) { c.observe = fn }
+
+func (c *Correlator) notify(out bool, m *iso8583.Message, key MatchKey, outcome string) {
+	if c.observe != nil {
+		c.observe(Event{Outbound: out, Msg: m, Key: key, Outcome: outcome})
+	}
+}
+
+// SendAndWait packs and sends m, then blocks until the matching response
+// arrives, the per-request timeout elapses or ctx is done.
+func (c *Correlator) SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+	b, err := m.Pack(c.spec)
+	if err != nil {
+		return nil, err
+	}
+	key := KeyOf(m)
+	w := &waiter{ch: make(chan *iso8583.Message, 1)}
+
+	c.mu.Lock()
+	if _, dup := c.pending[key]; dup {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, key)
+	}
+	c.pending[key] = w
+	c.mu.Unlock()
+	defer c.forget(key, w)
+
+	if err := c.s.Send(b); err != nil {
+		c.notify(true, m, key, OutcomeSendFailed)
+		return nil, err
+	}
+	c.notify(true, m, key, OutcomeSent)
+
+	t := time.NewTimer(c.timeout)
+	defer t.Stop()
+	select {
+	case resp := <-w.ch:
+		return resp, nil
+	case <-t.C:
+		c.notify(true, m, key, OutcomeTimeout)
+		return nil, ErrTimeout
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			c.notify(true, m, key, OutcomeTimeout)
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// forget drops the pending entry so a late response is treated as an orphan.
+func (c *Correlator) forget(key MatchKey, w *waiter) {
+	c.mu.Lock()
+	if c.pending[key] == w {
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+}
+
+// Deliver hands an inbound message to the correlator. Responses are always
+// consumed: they either complete a pending request or are counted and
+// reported as orphans. It returns false for anything else, such as
+// host-initiated requests, which the caller must handle itself.
+func (c *Correlator) Deliver(m *iso8583.Message) bool {
+	key := KeyOf(m)
+	if !IsResponse(m.MTI) {
+		c.notify(false, m, key, OutcomeUnsolicited)
+		return false
+	}
+	c.mu.Lock()
+	w, ok := c.pending[key]
+	if ok {
+		delete(c.pending, key)
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.orphans.Add(1)
+		c.notify(false, m, key, OutcomeOrphan)
+		if c.onOrphan != nil {
+			c.onOrphan(m)
+		}
+		return true
+	}
+	c.notify(false, m, key, OutcomeMatched)
+	w.ch <- m
+	return true
+}
+
+// Pending returns the number of requests waiting for a response.
+func (c *Correlator) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Orphans returns the number of unmatched responses seen so far.
+func (c *Correlator) Orphans() uint64 { return c.orphans.Load() }
@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+type sendFunc func([]byte) error
+
+func (f sendFunc) Send(b []byte) error { return f(b) }
+
+func TestCorrelatorMatchesResponse(t *testing.T) {
+	var c *Correlator
+	c = NewCorrelator(sendFunc(func(b []byte) error {
+		req, err := iso8583.Unpack(iso8583.DefaultSpec, b)
+		if err != nil {
+			return err
+		}
+		resp := iso8583.New("0810")
+		resp.Set(7, req.Fields[7])
+		resp.Set(11, req.Fields[11])
+		resp.Set(70, "301")
+		go c.Deliver(resp)
+		return nil
+	}), iso8583.DefaultSpec, time.Second)
+
+	resp, err := c.SendAndWait(context.Background(), iso8583.NewEchoRequest(42))
+	if err != nil {
+		t.Fatalf("SendAndWait: %v", err)
+	}
+	if !iso8583.IsEchoResponse(resp) || iso8583.MustParseSTAN(resp) != 42 {
+		t.Fatalf("unexpected response %s %v", resp.MTI, resp.Fields)
+	}
+	if c.Pending() != 0 {
+		t.Fatalf("pending = %d after response", c.Pending())
+	}
+}
+
+func TestCorrelatorTimeoutAndLateResponse(t *testing.T) {
+	c := NewCorrelator(sendFunc(func([]byte) error { return nil }), iso8583.DefaultSpec, 20*time.Millisecond)
+	var orphans int
+	c.SetOrphanHandler(func(*iso8583.Message) { orphans++ })
+
+	req := iso8583.NewEchoRequest(7)
+	if _, err := c.SendAndWait(context.Background(), req); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+
+	late := iso8583.New("0810")
+	late.Set(7, req.Fields[7])
+	late.Set(11, req.Fields[11])
+	if !c.Deliver(late) {
+		t.Fatalf("late response not consumed")
+	}
+	if orphans != 1 || c.Orphans() != 1 {
+		t.Fatalf("late response not reported as orphan: %d/%d", orphans, c.Orphans())
+	}
+}
+
+func TestCorrelatorIgnoresRequests(t *testing.T) {
+	c := NewCorrelator(sendFunc(func([]byte) error { return nil }), iso8583.DefaultSpec, time.Second)
+	if c.Deliver(iso8583.NewEchoRequest(1)) {
+		t.Fatalf("host request consumed by correlator")
+	}
+}
@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Framer splits an inbound byte stream into messages and wraps outbound
+// messages for the wire. Messages passed in and out are ISO8583 bodies as
+// produced by iso8583.Pack; the framer owns everything around them.
+type Framer interface {
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+	WriteFrame(w io.Writer, msg []byte) error
+}
+
+// MLIFormat is the encoding of the message length indicator.
+type MLIFormat int
+
+const (
+	MLI2BE    MLIFormat = iota // 2-byte big-endian binary
+	MLI2LE                     // 2-byte little-endian binary
+	MLI4BE                     // 4-byte big-endian binary
+	MLI4ASCII                  // 4 ASCII decimal digits
+)
+
+var mliNames = map[string]MLIFormat{
+	"2be":    MLI2BE,
+	"2le":    MLI2LE,
+	"4be":    MLI4BE,
+	"4ascii": MLI4ASCII,
+}
+
+func (f MLIFormat) size() int {
+	if f == MLI2BE || f == MLI2LE {
+		return 2
+	}
+	return 4
+}
+
+// limit is the largest length the MLI can express, capped at 64 KiB as a
+// sanity check on inbound lengths.
+func (f MLIFormat) limit() int {
+	switch f {
+	case MLI2BE, MLI2LE:
+		return 0xffff
+	case MLI4ASCII:
+		return 9999
+	}
+	return 64 * 1024
+}
+
+// MLIFramer prefixes each message with a length indicator and an optional
+// fixed header such as a 5-byte TPDU.
+type MLIFramer struct {
+	Format    MLIFormat
+	Inclusive bool   // MLI counts its own bytes
+	Header    []byte // written after the MLI; the same number of bytes is stripped on read
+}
+
+// DefaultFramer is the 2-byte big-endian MLI used when none is configured.
+var DefaultFramer Framer = MLIFramer{Format: MLI2BE}
+
+// NewFramer builds an MLIFramer from command-line style options: an MLI
+// format name (2be, 2le, 4be, 4ascii), whether the MLI includes itself,
+// and an optional hex-encoded header (e.g. TPDU "6000010000").
+func NewFramer(format string, inclusive bool, headerHex string) (Framer, error) {
+	f, ok := mliNames[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown MLI format %q", format)
+	}
+	hdr, err := hex.DecodeString(headerHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header hex: %w", err)
+	}
+	return MLIFramer{Format: f, Inclusive: inclusive, Header: hdr}, nil
+}
+
+func (f MLIFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	mli := make([]byte, f.Format.size())
+	if _, err := io.ReadFull(r, mli); err != nil {
+		return nil, err
+	}
+	var n int
+	switch f.Format {
+	case MLI2BE:
+		n = int(binary.BigEndian.Uint16(mli))
+	case MLI2LE:
+		n = int(binary.LittleEndian.Uint16(mli))
+	case MLI4BE:
+		n = int(binary.BigEndian.Uint32(mli))
+	case MLI4ASCII:
+		v, err := strconv.Atoi(string(mli))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MLI %q", mli)
+		}
+		n = v
+	}
+	if f.Inclusive {
+		n -= len(mli)
+	}
+	if n <= len(f.Header) || n > f.Format.limit() {
+		return nil, fmt.Errorf("invalid MLI %d", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload[len(f.Header):], nil
+}
+
+func (f MLIFramer) WriteFrame(w io.Writer, msg []byte) error {
+	n := len(f.Header) + len(msg)
+	if f.Inclusive {
+		n += f.Format.size()
+	}
+	if n > f.Format.limit() {
+		return fmt.Errorf("message too long: %d", n)
+	}
+	var buf bytes.Buffer
+	switch f.Format {
+	case MLI2BE:
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case MLI2LE:
+		buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(n)))
+	case MLI4BE:
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	case MLI4ASCII:
+		fmt.Fprintf(&buf, "%04d", n)
+	}
+	buf.Write(f.Header)
+	buf.Write(msg)
+	// One Write per frame so concurrent senders never interleave.
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestMLIFramerRoundTrip(t *testing.T) {
+	msg := []byte("0800PAYLOAD")
+	cases := []struct {
+		name   string
+		framer MLIFramer
+		wire   []byte
+	}{
+		{"2be", MLIFramer{Format: MLI2BE}, []byte{0x00, 0x0b}},
+		{"2le", MLIFramer{Format: MLI2LE}, []byte{0x0b, 0x00}},
+		{"4be", MLIFramer{Format: MLI4BE}, []byte{0x00, 0x00, 0x00, 0x0b}},
+		{"4ascii", MLIFramer{Format: MLI4ASCII}, []byte("0011")},
+		{"2be inclusive", MLIFramer{Format: MLI2BE, Inclusive: true}, []byte{0x00, 0x0d}},
+		{"4ascii inclusive", MLIFramer{Format: MLI4ASCII, Inclusive: true}, []byte("0015")},
+		{"tpdu", MLIFramer{Format: MLI2BE, Header: []byte{0x60, 0x00, 0x01, 0x00, 0x00}}, []byte{0x00, 0x10, 0x60, 0x00, 0x01, 0x00, 0x00}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tc.framer.WriteFrame(&buf, msg); err != nil {
+				t.Fatalf("WriteFrame: %v", err)
+			}
+			want := append(append([]byte{}, tc.wire...), msg...)
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("wire % x, want % x", buf.Bytes(), want)
+			}
+			// Two frames back to back must split cleanly.
+			buf.Write(want)
+			r := bufio.NewReader(&buf)
+			for i := 0; i < 2; i++ {
+				got, err := tc.framer.ReadFrame(r)
+				if err != nil {
+					t.Fatalf("ReadFrame %d: %v", i, err)
+				}
+				if !bytes.Equal(got, msg) {
+					t.Fatalf("ReadFrame %d got %q", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMLIFramerRejectsBadLength(t *testing.T) {
+	f := MLIFramer{Format: MLI4ASCII}
+	if _, err := f.ReadFrame(bufio.NewReader(bytes.NewReader([]byte("00x1ABC")))); err == nil {
+		t.Fatalf("expected invalid ASCII MLI error")
+	}
+	if err := f.WriteFrame(&bytes.Buffer{}, make([]byte, 10000)); err == nil {
+		t.Fatalf("expected too long error")
+	}
+	if _, err := NewFramer("3be", false, ""); err == nil {
+		t.Fatalf("expected unknown format error")
+	}
+}
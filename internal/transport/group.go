@@ -0,0 +1,237 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+// ErrNoHealthyLink is returned when every link in a Group is down.
+var ErrNoHealthyLink = errors.New("no healthy upstream link")
+
+// Link is one upstream connection in a Group: a Connector plus the
+// Correlator matching responses on it.
+type Link struct {
+	Name string
+	Conn *Connector
+	Corr *Correlator
+
+	up       atomic.Bool
+	held     atomic.Bool
+	degraded atomic.Bool
+
+	mu     sync.Mutex
+	health float64       // echo success rate, exponentially weighted
+	rtt    time.Duration // echo round-trip time, exponentially weighted
+}
+
+// NewLink creates a link to cfg.Endpoint. Call SetCallbacks before Start.
+func NewLink(name string, cfg DialConfig, spec *iso8583.Spec, timeout time.Duration) *Link {
+	c := NewConnector(cfg)
+	return &Link{Name: name, Conn: c, Corr: NewCorrelator(c, spec, timeout), health: 1}
+}
+
+// SetCallbacks mirrors Connector.SetCallbacks while tracking link state.
+func (l *Link) SetCallbacks(onMsg func([]byte), onUp func(), onDown func(error)) {
+	l.Conn.SetCallbacks(onMsg,
+		func() {
+			l.up.Store(true)
+			if onUp != nil {
+				onUp()
+			}
+		},
+		func(err error) {
+			l.up.Store(false)
+			if onDown != nil {
+				onDown(err)
+			}
+		})
+}
+
+// Up reports whether the link is connected.
+func (l *Link) Up() bool { return l.up.Load() }
+
+// SetHeld keeps a connected link out of rotation, e.g. until sign-on.
+// Link.SendAndWait still works on a held link.
+func (l *Link) SetHeld(held bool) { l.held.Store(held) }
+
+// SetDegraded keeps a link out of rotation while its echo tests fail.
+func (l *Link) SetDegraded(degraded bool) { l.degraded.Store(degraded) }
+
+// Degraded reports whether the link was marked degraded.
+func (l *Link) Degraded() bool { return l.degraded.Load() }
+
+// Reconnect drops the link's connection so that it is dialled again.
+func (l *Link) Reconnect() { l.Conn.Reconnect() }
+
+// Healthy reports whether the link may carry traffic.
+func (l *Link) Healthy() bool { return l.Up() && !l.held.Load() && !l.degraded.Load() }
+
+// Outstanding returns the number of requests awaiting a response.
+func (l *Link) Outstanding() int { return l.Corr.Pending() }
+
+// SendAndWait sends m on this link only.
+func (l *Link) SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+	return l.Corr.SendAndWait(ctx, m)
+}
+
+// RecordEcho feeds an echo test result into the link's health weight.
+func (l *Link) RecordEcho(err error, rtt time.Duration) {
+	const alpha = 0.3
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ok := 0.0
+	if err == nil {
+		ok = 1
+		if l.rtt == 0 {
+			l.rtt = rtt
+		} else {
+			l.rtt = time.Duration(float64(l.rtt)*(1-alpha) + float64(rtt)*alpha)
+		}
+	}
+	l.health = l.health*(1-alpha) + ok*alpha
+}
+
+// Weight is the link's share of traffic under PolicyEchoWeighted: its echo
+// success rate divided by its smoothed round-trip time in milliseconds.
+func (l *Link) Weight() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ms := float64(l.rtt) / float64(time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return l.health / ms
+}
+
+// Policy selects the link that carries the next request.
+type Policy int
+
+const (
+	PolicyFailover         Policy = iota // first healthy link in configured order
+	PolicyRoundRobin                     // rotate over healthy links
+	PolicyLeastOutstanding               // fewest requests awaiting a response
+	PolicyEchoWeighted                   // random, weighted by echo health
+)
+
+var policyNames = map[string]Policy{
+	"failover":          PolicyFailover,
+	"round-robin":       PolicyRoundRobin,
+	"least-outstanding": PolicyLeastOutstanding,
+	"echo-weighted":     PolicyEchoWeighted,
+}
+
+// ParsePolicy maps a policy name to a Policy.
+func ParsePolicy(s string) (Policy, error) {
+	p, ok := policyNames[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown policy %q", s)
+	}
+	return p, nil
+}
+
+// Group spreads requests over several links to the same acquirer.
+type Group struct {
+	links  []*Link
+	policy Policy
+	next   atomic.Uint64
+}
+
+// NewGroup creates a group. For PolicyFailover, links are in priority order.
+func NewGroup(policy Policy, links ...*Link) *Group {
+	return &Group{links: links, policy: policy}
+}
+
+// Links returns every link in configured order.
+func (g *Group) Links() []*Link { return g.links }
+
+// Start starts every link's connector.
+func (g *Group) Start() {
+	for _, l := range g.links {
+		l.Conn.Start()
+	}
+}
+
+// Close closes every link.
+func (g *Group) Close() {
+	for _, l := range g.links {
+		l.Conn.Close()
+	}
+}
+
+// Pick returns the link for the next request according to the policy.
+func (g *Group) Pick() (*Link, error) { return g.pick(nil) }
+
+// pick is Pick over the healthy links not in skip.
+func (g *Group) pick(skip map[*Link]bool) (*Link, error) {
+	healthy := make([]*Link, 0, len(g.links))
+	for _, l := range g.links {
+		if l.Healthy() && !skip[l] {
+			healthy = append(healthy, l)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyLink
+	}
+	switch g.policy {
+	case PolicyRoundRobin:
+		return healthy[int(g.next.Add(1)-1)%len(healthy)], nil
+	case PolicyLeastOutstanding:
+		best := healthy[0]
+		for _, l := range healthy[1:] {
+			if l.Outstanding() < best.Outstanding() {
+				best = l
+			}
+		}
+		return best, nil
+	case PolicyEchoWeighted:
+		var total float64
+		weights := make([]float64, len(healthy))
+		for i, l := range healthy {
+			weights[i] = l.Weight()
+			total += weights[i]
+		}
+		if total <= 0 {
+			return healthy[rand.IntN(len(healthy))], nil
+		}
+		r := rand.Float64() * total
+		for i, w := range weights {
+			if r < w {
+				return healthy[i], nil
+			}
+			r -= w
+		}
+		return healthy[len(healthy)-1], nil
+	}
+	return healthy[0], nil
+}
+
+// SendAndWait sends m on a link chosen by the policy and waits for the
+// matching response. If the chosen link turns out not to be connected, the
+// next one the policy picks is tried; any error once m may have been
+// written is returned as is.
+func (g *Group) SendAndWait(ctx context.Context, m *iso8583.Message) (*iso8583.Message, error) {
+	tried := make(map[*Link]bool)
+	var last error
+	for {
+		l, err := g.pick(tried)
+		if err != nil {
+			if last != nil {
+				return nil, last
+			}
+			return nil, err
+		}
+		resp, err := l.SendAndWait(ctx, m)
+		if !errors.Is(err, ErrNotConnected) {
+			return resp, err
+		}
+		tried[l] = true
+		last = fmt.Errorf("%s: %w", l.Name, err)
+	}
+}
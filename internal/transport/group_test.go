@@ -0,0 +1,121 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+)
+
+func testLinks(n int) []*Link {
+	links := make([]*Link, n)
+	for i := range links {
+		links[i] = NewLink(string(rune('a'+i)), DialConfig{Endpoint: "127.0.0.1:0"}, nil, time.Second)
+		links[i].up.Store(true)
+	}
+	return links
+}
+
+func TestGroupPolicies(t *testing.T) {
+	links := testLinks(3)
+
+	g := NewGroup(PolicyFailover, links...)
+	if l, _ := g.Pick(); l != links[0] {
+		t.Fatalf("failover picked %s", l.Name)
+	}
+	links[0].up.Store(false)
+	if l, _ := g.Pick(); l != links[1] {
+		t.Fatalf("failover to backup picked %s", l.Name)
+	}
+
+	g = NewGroup(PolicyRoundRobin, links...)
+	var got string
+	for i := 0; i < 4; i++ {
+		l, _ := g.Pick()
+		got += l.Name
+	}
+	if got != "bcbc" {
+		t.Fatalf("round-robin order %q", got)
+	}
+
+	links[0].up.Store(true)
+	links[0].Corr.pending[MatchKey{STAN: "000001"}] = nil
+	links[1].Corr.pending[MatchKey{STAN: "000002"}] = nil
+	g = NewGroup(PolicyLeastOutstanding, links...)
+	if l, _ := g.Pick(); l != links[2] {
+		t.Fatalf("least-outstanding picked %s", l.Name)
+	}
+
+	for i := 0; i < 10; i++ {
+		links[0].RecordEcho(errors.New("timeout"), 0)
+		links[1].RecordEcho(errors.New("timeout"), 0)
+		links[2].RecordEcho(nil, time.Millisecond)
+	}
+	g = NewGroup(PolicyEchoWeighted, links...)
+	hits := 0
+	for i := 0; i < 200; i++ {
+		if l, _ := g.Pick(); l == links[2] {
+			hits++
+		}
+	}
+	if hits < 150 {
+		t.Fatalf("echo-weighted picked healthy link %d/200 times", hits)
+	}
+
+	for _, l := range links {
+		l.up.Store(false)
+	}
+	if _, err := g.Pick(); !errors.Is(err, ErrNoHealthyLink) {
+		t.Fatalf("expected ErrNoHealthyLink, got %v", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if p, err := ParsePolicy("least-outstanding"); err != nil || p != PolicyLeastOutstanding {
+		t.Fatalf("got %v, %v", p, err)
+	}
+	if _, err := ParsePolicy("random"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+// echoSender answers every request at once through its correlator.
+type echoSender struct{ corr *Correlator }
+
+func (s *echoSender) Send(b []byte) error {
+	m, err := iso8583.Unpack(nil, b)
+	if err != nil {
+		return err
+	}
+	resp := iso8583.New(m.MTI[:2] + "10")
+	for _, f := range []int{7, 11, 37, 41} {
+		if v, ok := m.Get(f); ok {
+			resp.Set(f, v)
+		}
+	}
+	resp.Set(39, "00")
+	go s.corr.Deliver(resp)
+	return nil
+}
+
+func TestGroupFailsOverWhenNotConnected(t *testing.T) {
+	links := testLinks(3)
+	s := &echoSender{}
+	links[1].Corr = NewCorrelator(s, nil, time.Second)
+	s.corr = links[1].Corr
+	req := iso8583.NewEchoRequest(1)
+
+	// links[0] is marked up but has no connection yet.
+	g := NewGroup(PolicyFailover, links...)
+	resp, err := g.SendAndWait(context.Background(), req)
+	if err != nil || resp.MTI != "0810" {
+		t.Fatalf("SendAndWait = %v, %v", resp, err)
+	}
+
+	g = NewGroup(PolicyFailover, links[0], links[2])
+	if _, err := g.SendAndWait(context.Background(), req); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected once every link was tried, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-payment-gateway/internal/iso8583"
+	"go-payment-gateway/internal/sim"
+	"go-payment-gateway/internal/transport"
+)
+
+type client struct {
+	conn *transport.Connector
+	corr *transport.Correlator
+	ups  chan struct{}
+}
+
+// connect starts a simnet playing sc and a connector correlating on it.
+func connect(t *testing.T, sc *sim.Scenario, readIdle, timeout time.Duration) *client {
+	t.Helper()
+	srv, err := sim.Listen(sim.Config{Addr: "127.0.0.1:0", Scenario: sc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+
+	c := &client{ups: make(chan struct{}, 10)}
+	c.conn = transport.NewConnector(transport.DialConfig{
+		Endpoint:   srv.Addr().String(),
+		Timeout:    time.Second,
+		ReadIdle:   readIdle,
+		RetryBacko: 20 * time.Millisecond,
+	})
+	c.corr = transport.NewCorrelator(c.conn, nil, timeout)
+	c.conn.SetCallbacks(func(b []byte) {
+		if m, err := iso8583.Unpack(iso8583.DefaultSpec, b); err == nil {
+			c.corr.Deliver(m)
+		}
+	}, func() { c.ups <- struct{}{} }, nil)
+	c.conn.Start()
+	t.Cleanup(c.conn.Close)
+	c.waitUp(t)
+	return c
+}
+
+func (c *client) waitUp(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.ups:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("connector did not come up")
+	}
+}
+
+func (c *client) echo(stan int) (*iso8583.Message, error) {
+	return c.corr.SendAndWait(context.Background(), iso8583.NewEchoRequest(stan))
+}
+
+func faulty(f sim.Fault) *sim.Scenario {
+	return &sim.Scenario{Rules: []sim.Rule{{Fault: f}}}
+}
+
+func waitOrphans(t *testing.T, c *client, want uint64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for c.corr.Orphans() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("orphans = %d, want %d", c.corr.Orphans(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSplitWritesAreReassembled(t *testing.T) {
+	c := connect(t, faulty(sim.FaultSplitWrites), 5*time.Second, time.Second)
+	resp, err := c.echo(1)
+	if err != nil || !iso8583.IsEchoResponse(resp) {
+		t.Fatalf("echo: %v %+v", err, resp)
+	}
+}
+
+func TestWrongSTANTimesOutAndIsOrphaned(t *testing.T) {
+	c := connect(t, faulty(sim.FaultWrongSTAN), 5*time.Second, 200*time.Millisecond)
+	if _, err := c.echo(1); !errors.Is(err, transport.ErrTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	waitOrphans(t, c, 1)
+}
+
+func TestDuplicateResponseIsOrphaned(t *testing.T) {
+	c := connect(t, faulty(sim.FaultDuplicate), 5*time.Second, time.Second)
+	if _, err := c.echo(1); err != nil {
+		t.Fatalf("echo: %v", err)
+	}
+	waitOrphans(t, c, 1)
+}
+
+func TestStallTimesOutThenLateResponseIsOrphaned(t *testing.T) {
+	sc := &sim.Scenario{Rules: []sim.Rule{{Stall: sim.Duration(300 * time.Millisecond)}}}
+	c := connect(t, sc, 5*time.Second, 100*time.Millisecond)
+	if _, err := c.echo(1); !errors.Is(err, transport.ErrTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	waitOrphans(t, c, 1)
+}
+
+func TestConnectorReconnectsAfterFault(t *testing.T) {
+	cases := []struct {
+		name     string
+		sc       *sim.Scenario
+		readIdle time.Duration
+	}{
+		{"drop-mid-frame", faulty(sim.FaultDropMidFrame), 5 * time.Second},
+		{"truncated-mli", faulty(sim.FaultTruncatedMLI), 5 * time.Second},
+		{"close-after", &sim.Scenario{CloseAfter: 1}, 5 * time.Second},
+		// The garbage MLI announces a huge frame; only read idle ends it.
+		{"garbage", faulty(sim.FaultGarbage), 300 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := connect(t, tc.sc, tc.readIdle, 100*time.Millisecond)
+			c.echo(1)
+			c.waitUp(t)
+			if n := c.corr.Pending(); n != 0 {
+				t.Fatalf("pending = %d after reconnect", n)
+			}
+		})
+	}
+}
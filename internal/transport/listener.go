@@ -0,0 +1,202 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ListenConfig holds options for accepting inbound connections.
+type ListenConfig struct {
+	Addr     string        // listen host:port
+	ReadIdle time.Duration // per-read deadline, 0 = none
+	Framer   Framer        // message framing, DefaultFramer if nil
+	// OnAccept is called for each new session before its read loop starts;
+	// it typically registers the session's callbacks.
+	OnAccept func(*Session)
+}
+
+// Listener accepts connections from terminals or upstream issuers and
+// runs one Session per connection with the shared framing.
+type Listener struct {
+	cfg ListenConfig
+	ln  net.Listener
+
+	mu       sync.Mutex
+	sessions map[*Session]struct{}
+	wg       sync.WaitGroup
+	draining atomic.Bool
+	nextID   atomic.Uint64
+}
+
+// Listen binds cfg.Addr. Call Serve to start accepting.
+func Listen(cfg ListenConfig) (*Listener, error) {
+	if cfg.Framer == nil {
+		cfg.Framer = DefaultFramer
+	}
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{cfg: cfg, ln: ln, sessions: make(map[*Session]struct{})}, nil
+}
+
+// Addr returns the bound address.
+func (l *Listener) Addr() net.Addr { return l.ln.Addr() }
+
+// Serve accepts connections until Shutdown is called.
+func (l *Listener) Serve() error {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if l.draining.Load() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		s := &Session{
+			ID:     l.nextID.Add(1),
+			conn:   conn,
+			framer: l.cfg.Framer,
+			idle:   l.cfg.ReadIdle,
+		}
+		// Registering under mu orders this wg.Add before Shutdown's Wait:
+		// once draining is set, late connections are turned away.
+		l.mu.Lock()
+		if l.draining.Load() {
+			l.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		l.sessions[s] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+		if l.cfg.OnAccept != nil {
+			l.cfg.OnAccept(s)
+		}
+		go func() {
+			defer l.wg.Done()
+			err := s.readLoop()
+			l.mu.Lock()
+			delete(l.sessions, s)
+			l.mu.Unlock()
+			if s.onClose != nil {
+				s.onClose(err)
+			}
+		}()
+	}
+}
+
+// Sessions returns the currently connected sessions.
+func (l *Listener) Sessions() []*Session {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]*Session, 0, len(l.sessions))
+	for s := range l.sessions {
+		out = append(out, s)
+	}
+	return out
+}
+
+// Draining reports whether Shutdown has been called.
+func (l *Listener) Draining() bool { return l.draining.Load() }
+
+// Shutdown stops accepting and waits for open sessions to end on their
+// own. Sessions still open when ctx is done are closed.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.draining.Store(true)
+	l.mu.Unlock()
+	_ = l.ln.Close()
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, s := range l.Sessions() {
+			s.Close()
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Session is one accepted connection.
+type Session struct {
+	ID     uint64
+	conn   net.Conn
+	framer Framer
+	idle   time.Duration
+	closed atomic.Bool
+
+	onMsg   func([]byte) // callback on each ISO message body (framing removed)
+	onClose func(error)
+}
+
+// SetCallbacks registers the session's handlers. Call it from OnAccept.
+func (s *Session) SetCallbacks(onMsg func([]byte), onClose func(error)) {
+	s.onMsg, s.onClose = onMsg, onClose
+}
+
+// RemoteAddr returns the peer address.
+func (s *Session) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
+
+func (s *Session) String() string { return fmt.Sprintf("session %d (%s)", s.ID, s.conn.RemoteAddr()) }
+
+func (s *Session) readLoop() error {
+	defer s.Close()
+	reader := bufio.NewReader(s.conn)
+	for !s.closed.Load() {
+		if s.idle > 0 {
+			_ = s.conn.SetReadDeadline(time.Now().Add(s.idle))
+		}
+		msg, err := s.framer.ReadFrame(reader)
+		if err != nil {
+			return err
+		}
+		if s.onMsg != nil {
+			s.onMsg(msg)
+		}
+	}
+	return nil
+}
+
+// Send frames and writes one message body.
+func (s *Session) Send(b []byte) error {
+	if s.closed.Load() {
+		return fmt.Errorf("session closed")
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return s.framer.WriteFrame(s.conn, b)
+}
+
+// WriteRaw writes b as is, without framing. Simulators use it to send
+// malformed frames.
+func (s *Session) WriteRaw(b []byte) error {
+	if s.closed.Load() {
+		return fmt.Errorf("session closed")
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// Close closes the connection; the read loop then ends and onClose runs.
+func (s *Session) Close() {
+	if s.closed.CompareAndSwap(false, true) {
+		_ = s.conn.Close()
+	}
+}
@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenerEchoAndDrain(t *testing.T) {
+	framer := MLIFramer{Format: MLI4ASCII}
+	accepted := make(chan *Session, 1)
+	closed := make(chan error, 1)
+	l, err := Listen(ListenConfig{
+		Addr:   "127.0.0.1:0",
+		Framer: framer,
+		OnAccept: func(s *Session) {
+			s.SetCallbacks(func(msg []byte) { _ = s.Send(append([]byte("ECHO:"), msg...)) },
+				func(err error) { closed <- err })
+			accepted <- s
+		},
+	})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go l.Serve()
+
+	c := NewConnector(DialConfig{Endpoint: l.Addr().String(), Timeout: time.Second, ReadIdle: 5 * time.Second, Framer: framer})
+	got := make(chan string, 1)
+	up := make(chan struct{}, 1)
+	c.SetCallbacks(func(b []byte) { got <- string(b) }, func() { up <- struct{}{} }, func(error) {})
+	c.Start()
+	defer c.Close()
+
+	select {
+	case <-up:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("connector never came up")
+	}
+	<-accepted
+	if err := c.Send([]byte("0800")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case v := <-got:
+		if v != "ECHO:0800" {
+			t.Fatalf("got %q", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no reply")
+	}
+	if n := len(l.Sessions()); n != 1 {
+		t.Fatalf("sessions = %d", n)
+	}
+
+	// The connector stays connected, so drain must time out and force-close.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Shutdown(ctx); err == nil {
+		t.Fatalf("expected drain deadline to expire")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("session not closed after shutdown")
+	}
+	if !l.Draining() || len(l.Sessions()) != 0 {
+		t.Fatalf("listener not drained")
+	}
+}
+
+func TestShutdownWhileAccepting(t *testing.T) {
+	l, err := Listen(ListenConfig{Addr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- l.Serve() }()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if c, err := net.Dial("tcp", l.Addr().String()); err == nil {
+					c.Close()
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := l.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if n := len(l.Sessions()); n != 0 {
+		t.Fatalf("%d sessions escaped the drain", n)
+	}
+}
@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSOptions configures TLS to an upstream host. Server certificates are
+// always verified unless InsecureSkipVerify is set.
+type TLSOptions struct {
+	CAFile       string   // PEM bundle of trusted roots, system roots if empty
+	CertFile     string   // client certificate for mutual TLS
+	KeyFile      string   // client private key
+	ServerName   string   // name to verify, defaults to the endpoint host
+	MinVersion   uint16   // tls.VersionTLS12 if zero
+	CipherSuites []uint16 // TLS 1.2 suites, Go defaults if nil
+	// PinnedSPKI holds base64 SHA-256 hashes of SubjectPublicKeyInfo. If
+	// set, some certificate in the verified chain (the leaf itself with
+	// InsecureSkipVerify) must match one of them.
+	PinnedSPKI         []string
+	InsecureSkipVerify bool // lab use only
+}
+
+// Config builds the tls.Config used to dial endpoint.
+func (o *TLSOptions) Config(endpoint string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         o.MinVersion,
+		CipherSuites:       o.CipherSuites,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerName = host
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if len(o.PinnedSPKI) > 0 {
+		pins := make(map[string]bool, len(o.PinnedSPKI))
+		for _, p := range o.PinnedSPKI {
+			pins[p] = true
+		}
+		// Only certificates in a verified chain count: the peer can send
+		// any certificate it likes alongside its own. Without verification
+		// there is no chain, so the leaf itself must be pinned.
+		skip := o.InsecureSkipVerify
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if skip {
+				if len(cs.PeerCertificates) > 0 && pins[SPKIHash(cs.PeerCertificates[0])] {
+					return nil
+				}
+				return errors.New("peer certificate does not match a pinned SPKI hash")
+			}
+			for _, chain := range cs.VerifiedChains {
+				for _, c := range chain {
+					if pins[SPKIHash(c)] {
+						return nil
+					}
+				}
+			}
+			return errors.New("no certificate in the verified chain matches a pinned SPKI hash")
+		}
+	}
+	return cfg, nil
+}
+
+// TLSInfo summarises a completed handshake for monitoring.
+type TLSInfo struct {
+	Version        string    `json:"version"`
+	CipherSuite    string    `json:"cipher_suite"`
+	ServerName     string    `json:"server_name"`
+	Verified       bool      `json:"verified"`
+	PeerSubject    string    `json:"peer_subject"`
+	PeerNotAfter   time.Time `json:"peer_not_after"`
+	ClientNotAfter time.Time `json:"client_not_after"` // zero without mutual TLS
+}
+
+func newTLSInfo(cs tls.ConnectionState, cfg *tls.Config) *TLSInfo {
+	info := &TLSInfo{
+		Version:     tls.VersionName(cs.Version),
+		CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+		ServerName:  cfg.ServerName,
+		Verified:    !cfg.InsecureSkipVerify,
+	}
+	if len(cs.PeerCertificates) > 0 {
+		leaf := cs.PeerCertificates[0]
+		info.PeerSubject = leaf.Subject.String()
+		info.PeerNotAfter = leaf.NotAfter
+	}
+	if len(cfg.Certificates) > 0 && cfg.Certificates[0].Leaf != nil {
+		info.ClientNotAfter = cfg.Certificates[0].Leaf.NotAfter
+	}
+	return info
+}
+
+// SPKIHash returns the base64 SHA-256 hash of a certificate's public key
+// info, the form used for PinnedSPKI.
+func SPKIHash(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParseTLSVersion maps "1.2" or "1.3" to a tls.Version constant.
+func ParseTLSVersion(s string) (uint16, error) {
+	switch s {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q", s)
+}
+
+// ParseCipherSuites maps a comma-separated list of Go cipher suite names
+// (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) to their IDs. Insecure
+// suites are rejected.
+func ParseCipherSuites(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	byName := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		byName[cs.Name] = cs.ID
+	}
+	var ids []uint16
+	for _, name := range strings.Split(s, ",") {
+		id, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
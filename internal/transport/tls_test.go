@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func issue(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signKey := tmpl, key
+	if parent != nil {
+		signer, signKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := x509.ParseCertificate(der)
+	return &testCert{cert: c, key: key}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	kb, _ := x509.MarshalECPrivateKey(c.key)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0o600)
+	return certFile, keyFile
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func TestMutualTLSWithPinning(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "test-ca", nil, true)
+	server := issue(t, "acquirer", ca, false)
+	client := issue(t, "gateway", ca, false)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := client.write(t, dir, "client")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server.tls()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _ = c.(*tls.Conn).Handshake(); time.Sleep(100 * time.Millisecond); c.Close() }()
+		}
+	}()
+
+	dial := func(o *TLSOptions) (*TLSInfo, error) {
+		c := NewConnector(DialConfig{Endpoint: ln.Addr().String(), TLS: o, Timeout: time.Second})
+		if err := c.dial(); err != nil {
+			return nil, err
+		}
+		defer c.Close()
+		return c.TLSInfo(), nil
+	}
+
+	opts := &TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, PinnedSPKI: []string{SPKIHash(server.cert)}}
+	info, err := dial(opts)
+	if err != nil {
+		t.Fatalf("mutual TLS dial: %v", err)
+	}
+	if !info.Verified || info.PeerSubject != "CN=acquirer" || info.PeerNotAfter.IsZero() || info.ClientNotAfter.IsZero() {
+		t.Fatalf("unexpected TLS info %+v", info)
+	}
+
+	opts.PinnedSPKI = []string{SPKIHash(client.cert)}
+	if _, err := dial(opts); err == nil {
+		t.Fatalf("expected pin mismatch to fail")
+	}
+
+	if _, err := dial(&TLSOptions{CertFile: certFile, KeyFile: keyFile}); err == nil {
+		t.Fatalf("expected unknown CA to fail")
+	}
+}
+
+// serveTLS accepts TLS connections presenting leaf, followed by the extra
+// certificates, until the test ends.
+func serveTLS(t *testing.T, leaf *testCert, extra ...*testCert) string {
+	t.Helper()
+	cert := leaf.tls()
+	for _, c := range extra {
+		cert.Certificate = append(cert.Certificate, c.cert.Raw)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _ = c.(*tls.Conn).Handshake(); time.Sleep(100 * time.Millisecond); c.Close() }()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPinIgnoresUnverifiedChainEntries(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "test-ca", nil, true)
+	pinned := issue(t, "pinned-ca", nil, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	// A leaf from a trusted but unpinned CA, sent with the public pinned CA
+	// certificate tacked on.
+	addr := serveTLS(t, issue(t, "impostor", ca, false), pinned)
+
+	dial := func(o *TLSOptions) error {
+		c := NewConnector(DialConfig{Endpoint: addr, TLS: o, Timeout: time.Second})
+		if err := c.dial(); err != nil {
+			return err
+		}
+		c.Close()
+		return nil
+	}
+	if err := dial(&TLSOptions{CAFile: caFile, PinnedSPKI: []string{SPKIHash(pinned.cert)}}); err == nil {
+		t.Fatal("pin matched a certificate outside the verified chain")
+	}
+	if err := dial(&TLSOptions{CAFile: caFile, PinnedSPKI: []string{SPKIHash(ca.cert)}}); err != nil {
+		t.Fatalf("pinning the trusted root: %v", err)
+	}
+	if err := dial(&TLSOptions{InsecureSkipVerify: true, PinnedSPKI: []string{SPKIHash(pinned.cert)}}); err == nil {
+		t.Fatal("unverified pin matched a certificate other than the leaf")
+	}
+}